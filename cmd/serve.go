@@ -3,6 +3,7 @@ package cmd
 import (
 	"github.com/labbsr0x/go-horse/filters"
 	filterConfig "github.com/labbsr0x/go-horse/filters/config-filter"
+	"github.com/labbsr0x/go-horse/filters/filterproc"
 	"github.com/labbsr0x/go-horse/web"
 	webConfig "github.com/labbsr0x/go-horse/web/config-web"
 	"github.com/spf13/cobra"
@@ -35,12 +36,17 @@ command line option                 environment variable
 	RunE: func(cmd *cobra.Command, args []string) error {
 
 		filterBuilder := new(filterConfig.FilterBuilder).InitFromViper(viper.GetViper())
-		filter := new(filters.FilterManager).InitFromFilterBuilder(filterBuilder)
+		filter, err := new(filters.FilterManager).InitFromFilterBuilder(filterBuilder)
+		if err != nil {
+			return err
+		}
 
 		webBuilder := new(webConfig.WebBuilder).InitFromViper(viper.GetViper(), filter)
 		server := new(web.Server).InitFromWebBuilder(webBuilder)
 
 		filter.ListAPIs.Init()
+		defer filter.Store.Close()
+		defer filterproc.StopAll()
 
 		return server.Run()
 	},
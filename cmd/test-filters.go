@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/labbsr0x/go-horse/filters"
+	filterConfig "github.com/labbsr0x/go-horse/filters/config-filter"
+	"github.com/labbsr0x/go-horse/filters/filterproc"
+	"github.com/labbsr0x/go-horse/filters/store"
+	"github.com/labbsr0x/go-horse/filtertest"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	junitReport   = "junit-report"
+	testsLogLevel = "log-level"
+)
+
+// testFiltersCmd represents the test-filters command
+var testFiltersCmd = &cobra.Command{
+	Use:   "test-filters [fixture files or dirs...]",
+	Short: "Runs the filters against fixture files, with a mocked docker daemon",
+	Example: `
+./go-horse test-filters \
+  --js-filters-path /app/go-horse/filters \
+  --go-plugins-path /app/go-horse/plugins \
+  --junit-report report.xml \
+  /app/go-horse/filters-tests
+
+Each fixture file, YAML or JSON, holds a fixture or a list of fixtures : the client request, the mocked daemon response
+and the expected results. The JUnit XML report is written to the standard output unless --junit-report is set.
+The command fails when a fixture fails or a filter can't be loaded.
+	`,
+	Args:          cobra.MinimumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		// bound on run, the serve command binds the same flag names
+		return viper.GetViper().BindPFlags(cmd.Flags())
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		level, err := logrus.ParseLevel(viper.GetString(testsLogLevel))
+		if err != nil {
+			return err
+		}
+		logrus.SetLevel(level)
+
+		filterBuilder := new(filterConfig.FilterBuilder).InitFromViper(viper.GetViper())
+		// the runner gives the filters a memory store, the store of a running go-horse, like its bolt file, is never opened
+		filterBuilder.StoreBackend, filterBuilder.StorePath = store.Memory, ""
+		filter, err := new(filters.FilterManager).InitFromFilterBuilder(filterBuilder)
+		if err != nil {
+			return err
+		}
+		filter.ListAPIs.Load()
+		defer filterproc.StopAll()
+		// the process filters join the filter chain once started
+		if filterproc.WaitStarted() {
+			filter.ListAPIs.Load()
+		}
+
+		runner, err := filtertest.NewRunner(filter, level.String())
+		if err != nil {
+			return err
+		}
+		defer runner.Close()
+
+		var suites []filtertest.Suite
+		if loadErrors := filter.ListAPIs.LoadErrors(); len(loadErrors) > 0 {
+			suite := filtertest.Suite{Name: "filters load"}
+			for _, loadError := range loadErrors {
+				name := loadError.Filter
+				if name == "" {
+					name = loadError.File
+				}
+				suite.Results = append(suite.Results, filtertest.Result{Name: name, Failures: []string{loadError.Error}})
+			}
+			suites = append(suites, suite)
+		}
+
+		files, err := filtertest.FixtureFiles(args)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			suite := filtertest.Suite{Name: file}
+			fixtures, err := filtertest.LoadFixtures(file)
+			if err != nil {
+				suite.Results = append(suite.Results, filtertest.Result{Name: file, Error: fmt.Errorf("error reading the fixture file : %v", err)})
+			}
+			for _, fixture := range fixtures {
+				suite.Results = append(suite.Results, runner.Run(fixture))
+			}
+			suites = append(suites, suite)
+		}
+
+		total, failed := 0, 0
+		for _, suite := range suites {
+			for _, result := range suite.Results {
+				total++
+				if result.Passed() {
+					fmt.Fprintf(os.Stderr, "ok   %s : %s\n", suite.Name, result.Name)
+					continue
+				}
+				failed++
+				fmt.Fprintf(os.Stderr, "FAIL %s : %s\n", suite.Name, result.Name)
+				if result.Error != nil {
+					fmt.Fprintf(os.Stderr, "     %v\n", result.Error)
+				}
+				for _, failure := range result.Failures {
+					fmt.Fprintf(os.Stderr, "     %s\n", failure)
+				}
+			}
+		}
+
+		var report io.Writer = os.Stdout
+		if path := viper.GetString(junitReport); path != "" {
+			file, err := os.Create(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			report = file
+		}
+		if err := filtertest.WriteJUnit(report, suites); err != nil {
+			return err
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d of %d filter tests failed", failed, total)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(testFiltersCmd)
+
+	filterConfig.AddFlags(testFiltersCmd.Flags())
+	testFiltersCmd.Flags().String(junitReport, "", "[optional] File of the JUnit XML report. Defaults to the standard output")
+	testFiltersCmd.Flags().StringP(testsLogLevel, "l", "warn", "[optional] Sets the Log Level to one of seven (trace, debug, info, warn, error, fatal, panic). Defaults to warn")
+}
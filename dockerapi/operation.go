@@ -0,0 +1,131 @@
+package dockerapi
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/kataras/iris"
+	"github.com/labbsr0x/go-horse/util"
+)
+
+// OperationKey request scope key where the resolved operation is kept
+const OperationKey = "dockerOperation"
+
+func init() {
+	util.ProtectRequestScopeKeys(OperationKey)
+}
+
+// Operation a Docker Engine API operation resolved from a request
+type Operation struct {
+	// ID operation ID as named in the Engine API specification, like ContainerCreate. Empty when unknown
+	ID string `json:"id"`
+	// Version API version prefix of the request path, like 1.39. Empty for unversioned paths
+	Version string `json:"version,omitempty"`
+	// Params named path parameters, like id or name
+	Params map[string]string `json:"params,omitempty"`
+}
+
+type route struct {
+	method string
+	path   string
+	id     string
+}
+
+type compiledRoute struct {
+	route
+	regex *regexp.Regexp
+}
+
+var versionPrefix = regexp.MustCompile(`^/v([0-9]+(?:\.[0-9]+)*)(/.*)$`)
+var pathParam = regexp.MustCompile(`\{([a-zA-Z]+)(:\.\*)?\}`)
+
+var compiledRoutes = compileRoutes(routes)
+
+func compileRoutes(routes []route) []compiledRoute {
+	compiled := make([]compiledRoute, 0, len(routes))
+	for _, r := range routes {
+		pattern := ""
+		last := 0
+		for _, loc := range pathParam.FindAllStringSubmatchIndex(r.path, -1) {
+			pattern += regexp.QuoteMeta(r.path[last:loc[0]])
+			name := r.path[loc[2]:loc[3]]
+			if loc[4] >= 0 {
+				pattern += "(?P<" + name + ">.+)"
+			} else {
+				pattern += "(?P<" + name + ">[^/]+)"
+			}
+			last = loc[1]
+		}
+		pattern += regexp.QuoteMeta(r.path[last:])
+		compiled = append(compiled, compiledRoute{route: r, regex: regexp.MustCompile("^" + pattern + "$")})
+	}
+	return compiled
+}
+
+// Resolve resolves the Docker Engine API operation of a request, with or without the API version prefix
+func Resolve(method, path string) Operation {
+	operation := Operation{}
+	if match := versionPrefix.FindStringSubmatch(path); match != nil {
+		operation.Version = match[1]
+		path = match[2]
+	}
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	method = strings.ToUpper(method)
+	for _, r := range compiledRoutes {
+		if r.method != method {
+			continue
+		}
+		match := r.regex.FindStringSubmatch(path)
+		if match == nil {
+			continue
+		}
+		operation.ID = r.id
+		for i, name := range r.regex.SubexpNames() {
+			if i == 0 || name == "" {
+				continue
+			}
+			if operation.Params == nil {
+				operation.Params = make(map[string]string)
+			}
+			operation.Params[name] = match[i]
+		}
+		break
+	}
+	return operation
+}
+
+// FromContext returns the operation of the request, resolving it once per request
+func FromContext(ctx iris.Context) Operation {
+	if operation, ok := ctx.Values().Get(OperationKey).(Operation); ok {
+		return operation
+	}
+	operation := Resolve(ctx.Method(), ctx.Request().URL.Path)
+	ctx.Values().Set(OperationKey, operation)
+	return operation
+}
+
+// Known tells if the ID is the ID of an operation of the Engine API, or one of its aliases
+func Known(id string) bool {
+	if _, ok := aliases[id]; ok {
+		return true
+	}
+	for _, route := range routes {
+		if route.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Is tells if the operation has the given ID or one of its aliases
+func (o Operation) Is(id string) bool {
+	if o.ID == "" {
+		return false
+	}
+	if alias, ok := aliases[id]; ok {
+		id = alias
+	}
+	return o.ID == id
+}
@@ -0,0 +1,67 @@
+package dockerapi
+
+import (
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	cases := []struct {
+		method  string
+		path    string
+		id      string
+		version string
+		params  map[string]string
+	}{
+		{"GET", "/_ping", "SystemPing", "", nil},
+		{"HEAD", "/_ping", "SystemPingHead", "", nil},
+		{"GET", "/containers/json", "ContainerList", "", nil},
+		{"GET", "/v1.39/containers/json", "ContainerList", "1.39", nil},
+		{"post", "/v1.39/containers/create", "ContainerCreate", "1.39", nil},
+		{"POST", "/v1.40/containers/3f4e/start", "ContainerStart", "1.40", map[string]string{"id": "3f4e"}},
+		{"DELETE", "/containers/3f4e", "ContainerDelete", "", map[string]string{"id": "3f4e"}},
+		{"POST", "/v1.39/images/create", "ImageCreate", "1.39", nil},
+		{"GET", "/v1.39/images/library/redis:latest/json", "ImageInspect", "1.39", map[string]string{"name": "library/redis:latest"}},
+		{"DELETE", "/images/registry:5000/team/app:1.0", "ImageDelete", "", map[string]string{"name": "registry:5000/team/app:1.0"}},
+		{"POST", "/v1.39/exec/abc/start", "ExecStart", "1.39", map[string]string{"id": "abc"}},
+		{"GET", "/volumes/data/", "VolumeInspect", "", map[string]string{"name": "data"}},
+		{"GET", "/v1.39/nope", "", "1.39", nil},
+		{"PUT", "/containers/json", "", "", nil},
+	}
+
+	for _, c := range cases {
+		operation := Resolve(c.method, c.path)
+		if operation.ID != c.id || operation.Version != c.version {
+			t.Errorf("%s %s : expected %q version %q, got %q version %q", c.method, c.path, c.id, c.version, operation.ID, operation.Version)
+		}
+		if len(operation.Params) != len(c.params) {
+			t.Errorf("%s %s : expected params %v, got %v", c.method, c.path, c.params, operation.Params)
+			continue
+		}
+		for key, value := range c.params {
+			if operation.Params[key] != value {
+				t.Errorf("%s %s : expected param %s=%q, got %q", c.method, c.path, key, value, operation.Params[key])
+			}
+		}
+	}
+}
+
+func TestOperationIsAlias(t *testing.T) {
+	operation := Resolve("POST", "/v1.39/images/create")
+	if !operation.Is("ImagePull") || !operation.Is("ImageCreate") {
+		t.Errorf("expected ImageCreate to match its ImagePull alias")
+	}
+	if operation.Is("ImagePush") {
+		t.Errorf("unexpected match of ImagePush")
+	}
+	if (Operation{}).Is("") {
+		t.Errorf("an unknown operation should not match anything")
+	}
+}
+
+func TestKnown(t *testing.T) {
+	for id, known := range map[string]bool{"ContainerCreate": true, "ImagePull": true, "ContainerCreat": false, "": false} {
+		if Known(id) != known {
+			t.Errorf("%q : expected known %v", id, known)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package dockerapi
+
+// routes Docker Engine API endpoints and their operation IDs, as named in the Engine API specification.
+// Literal paths must come before the parametrized ones sharing the same prefix.
+// A {param} matches a single path segment, a {param:.*} matches the rest of the path, like image and plugin names with slashes
+var routes = []route{
+	// containers
+	{"GET", "/containers/json", "ContainerList"},
+	{"POST", "/containers/create", "ContainerCreate"},
+	{"POST", "/containers/prune", "ContainerPrune"},
+	{"GET", "/containers/{id}/json", "ContainerInspect"},
+	{"GET", "/containers/{id}/top", "ContainerTop"},
+	{"GET", "/containers/{id}/logs", "ContainerLogs"},
+	{"GET", "/containers/{id}/changes", "ContainerChanges"},
+	{"GET", "/containers/{id}/export", "ContainerExport"},
+	{"GET", "/containers/{id}/stats", "ContainerStats"},
+	{"POST", "/containers/{id}/resize", "ContainerResize"},
+	{"POST", "/containers/{id}/start", "ContainerStart"},
+	{"POST", "/containers/{id}/stop", "ContainerStop"},
+	{"POST", "/containers/{id}/restart", "ContainerRestart"},
+	{"POST", "/containers/{id}/kill", "ContainerKill"},
+	{"POST", "/containers/{id}/update", "ContainerUpdate"},
+	{"POST", "/containers/{id}/rename", "ContainerRename"},
+	{"POST", "/containers/{id}/pause", "ContainerPause"},
+	{"POST", "/containers/{id}/unpause", "ContainerUnpause"},
+	{"POST", "/containers/{id}/attach", "ContainerAttach"},
+	{"GET", "/containers/{id}/attach/ws", "ContainerAttachWebsocket"},
+	{"POST", "/containers/{id}/wait", "ContainerWait"},
+	{"POST", "/containers/{id}/exec", "ContainerExec"},
+	{"HEAD", "/containers/{id}/archive", "ContainerArchiveInfo"},
+	{"GET", "/containers/{id}/archive", "ContainerArchive"},
+	{"PUT", "/containers/{id}/archive", "PutContainerArchive"},
+	{"DELETE", "/containers/{id}", "ContainerDelete"},
+
+	// images
+	{"GET", "/images/json", "ImageList"},
+	{"POST", "/build", "ImageBuild"},
+	{"POST", "/build/prune", "BuildPrune"},
+	{"POST", "/images/create", "ImageCreate"},
+	{"GET", "/images/search", "ImageSearch"},
+	{"POST", "/images/prune", "ImagePrune"},
+	{"POST", "/images/load", "ImageLoad"},
+	{"GET", "/images/get", "ImageGetAll"},
+	{"POST", "/commit", "ImageCommit"},
+	{"GET", "/images/{name:.*}/json", "ImageInspect"},
+	{"GET", "/images/{name:.*}/history", "ImageHistory"},
+	{"POST", "/images/{name:.*}/push", "ImagePush"},
+	{"POST", "/images/{name:.*}/tag", "ImageTag"},
+	{"GET", "/images/{name:.*}/get", "ImageGet"},
+	{"DELETE", "/images/{name:.*}", "ImageDelete"},
+	{"GET", "/distribution/{name:.*}/json", "DistributionInspect"},
+
+	// system
+	{"POST", "/auth", "SystemAuth"},
+	{"GET", "/info", "SystemInfo"},
+	{"GET", "/version", "SystemVersion"},
+	{"GET", "/_ping", "SystemPing"},
+	{"HEAD", "/_ping", "SystemPingHead"},
+	{"GET", "/events", "SystemEvents"},
+	{"GET", "/system/df", "SystemDataUsage"},
+	{"POST", "/session", "Session"},
+
+	// exec
+	{"POST", "/exec/{id}/start", "ExecStart"},
+	{"POST", "/exec/{id}/resize", "ExecResize"},
+	{"GET", "/exec/{id}/json", "ExecInspect"},
+
+	// volumes
+	{"GET", "/volumes", "VolumeList"},
+	{"POST", "/volumes/create", "VolumeCreate"},
+	{"POST", "/volumes/prune", "VolumePrune"},
+	{"GET", "/volumes/{name}", "VolumeInspect"},
+	{"DELETE", "/volumes/{name}", "VolumeDelete"},
+
+	// networks
+	{"GET", "/networks", "NetworkList"},
+	{"POST", "/networks/create", "NetworkCreate"},
+	{"POST", "/networks/prune", "NetworkPrune"},
+	{"GET", "/networks/{id}", "NetworkInspect"},
+	{"DELETE", "/networks/{id}", "NetworkDelete"},
+	{"POST", "/networks/{id}/connect", "NetworkConnect"},
+	{"POST", "/networks/{id}/disconnect", "NetworkDisconnect"},
+
+	// plugins
+	{"GET", "/plugins", "PluginList"},
+	{"GET", "/plugins/privileges", "GetPluginPrivileges"},
+	{"POST", "/plugins/pull", "PluginPull"},
+	{"POST", "/plugins/create", "PluginCreate"},
+	{"GET", "/plugins/{name:.*}/json", "PluginInspect"},
+	{"POST", "/plugins/{name:.*}/enable", "PluginEnable"},
+	{"POST", "/plugins/{name:.*}/disable", "PluginDisable"},
+	{"POST", "/plugins/{name:.*}/upgrade", "PluginUpgrade"},
+	{"POST", "/plugins/{name:.*}/push", "PluginPush"},
+	{"POST", "/plugins/{name:.*}/set", "PluginSet"},
+	{"DELETE", "/plugins/{name:.*}", "PluginDelete"},
+
+	// swarm
+	{"GET", "/swarm", "SwarmInspect"},
+	{"POST", "/swarm/init", "SwarmInit"},
+	{"POST", "/swarm/join", "SwarmJoin"},
+	{"POST", "/swarm/leave", "SwarmLeave"},
+	{"POST", "/swarm/update", "SwarmUpdate"},
+	{"GET", "/swarm/unlockkey", "SwarmUnlockkey"},
+	{"POST", "/swarm/unlock", "SwarmUnlock"},
+
+	// nodes
+	{"GET", "/nodes", "NodeList"},
+	{"GET", "/nodes/{id}", "NodeInspect"},
+	{"DELETE", "/nodes/{id}", "NodeDelete"},
+	{"POST", "/nodes/{id}/update", "NodeUpdate"},
+
+	// services
+	{"GET", "/services", "ServiceList"},
+	{"POST", "/services/create", "ServiceCreate"},
+	{"GET", "/services/{id}", "ServiceInspect"},
+	{"DELETE", "/services/{id}", "ServiceDelete"},
+	{"POST", "/services/{id}/update", "ServiceUpdate"},
+	{"GET", "/services/{id}/logs", "ServiceLogs"},
+
+	// tasks
+	{"GET", "/tasks", "TaskList"},
+	{"GET", "/tasks/{id}", "TaskInspect"},
+	{"GET", "/tasks/{id}/logs", "TaskLogs"},
+
+	// secrets
+	{"GET", "/secrets", "SecretList"},
+	{"POST", "/secrets/create", "SecretCreate"},
+	{"GET", "/secrets/{id}", "SecretInspect"},
+	{"DELETE", "/secrets/{id}", "SecretDelete"},
+	{"POST", "/secrets/{id}/update", "SecretUpdate"},
+
+	// configs
+	{"GET", "/configs", "ConfigList"},
+	{"POST", "/configs/create", "ConfigCreate"},
+	{"GET", "/configs/{id}", "ConfigInspect"},
+	{"DELETE", "/configs/{id}", "ConfigDelete"},
+	{"POST", "/configs/{id}/update", "ConfigUpdate"},
+}
+
+// aliases friendlier names accepted in the filters definitions for some operation IDs
+var aliases = map[string]string{
+	"ImagePull":   "ImageCreate",
+	"ImageImport": "ImageCreate",
+}
@@ -10,14 +10,48 @@ import (
 
 // All envs that GHP need to work with
 const (
-	jsFiltersPath = "js-filters-path"
-	goPluginsPath = "go-plugins-path"
+	jsFiltersPath      = "js-filters-path"
+	goPluginsPath      = "go-plugins-path"
+	processFiltersPath = "process-filters-path"
+	filterTraceHistory = "filter-trace-history"
+	jsEngine           = "js-engine"
+	jsVMPoolSize       = "js-vm-pool-size"
+	jsCPUBudget        = "js-cpu-budget"
+	jsMaxResultSize    = "js-max-result-size"
+	jsDeniedGlobals    = "js-denied-globals"
+	jsHTTPTimeout      = "js-http-timeout"
+	jsHTTPAllowedHosts = "js-http-allowed-hosts"
+	jsHTTPCert         = "js-http-cert"
+	jsHTTPKey          = "js-http-key"
+	jsHTTPCA           = "js-http-ca"
+	jsHTTPRetries      = "js-http-retries"
+	jsCaptureConsole   = "js-capture-console"
+	jsErrorDetails     = "js-error-details"
+	storeBackend       = "store-backend"
+	storePath          = "store-path"
 )
 
 // Flags define the fields that will be passed via cmd
 type FlagsFilter struct {
-	JsFiltersPath string
-	GoPluginsPath string
+	JsFiltersPath      string
+	GoPluginsPath      string
+	ProcessFiltersPath string
+	FilterTraceHistory int
+	JsEngine           string
+	JsVMPoolSize       int
+	JsCPUBudget        int
+	JsMaxResultSize    int
+	JsDeniedGlobals    []string
+	JsHTTPTimeout      int
+	JsHTTPAllowedHosts []string
+	JsHTTPCert         string
+	JsHTTPKey          string
+	JsHTTPCA           string
+	JsHTTPRetries      int
+	JsCaptureConsole   bool
+	JsErrorDetails     bool
+	StoreBackend       string
+	StorePath          string
 }
 
 // FilterBuilder defines the parametric information of a go horse filters instance
@@ -30,6 +64,23 @@ type FilterBuilder struct {
 func AddFlags(flags *pflag.FlagSet) {
 	flags.StringP(jsFiltersPath, "j", "", "Sets the path to json filters")
 	flags.StringP(goPluginsPath, "g", "", "Sets the path to go plugins")
+	flags.String(processFiltersPath, "", "[optional] Sets the path to the executables of the process filters, spawned and supervised by go-horse")
+	flags.Int(filterTraceHistory, 100, "[optional] How many request filter traces are kept for the /filter-traces endpoint. Defaults to 100")
+	flags.String(jsEngine, "otto", "[optional] JS engine of the filters that don't declare one : otto (ES5) or goja (ES2015+). Defaults to otto")
+	flags.Int(jsVMPoolSize, 8, "[optional] Maximum number of JS VMs kept per JS filter, the executions beyond that wait for a free VM. Defaults to 8")
+	flags.Int(jsCPUBudget, 5000, "[optional] Milliseconds a JS filter can spend running JS before it is interrupted, unless the filter sets its own cpuBudget. The HTTP and docker calls don't count, they have their own timeouts. 0 disables the budget. Defaults to 5000")
+	flags.Int(jsMaxResultSize, 16*1024*1024, "[optional] Maximum size in bytes of the body returned by a JS filter. 0 disables the limit. Defaults to 16MiB")
+	flags.StringSlice(jsDeniedGlobals, []string{}, "[optional] JS globals the filters can't use, like eval. JSON and Object can't be denied")
+	flags.Int(jsHTTPTimeout, 10000, "[optional] Default timeout in milliseconds of the HTTP calls of the JS filters, retries included. Defaults to 10000")
+	flags.StringSlice(jsHTTPAllowedHosts, []string{}, "[optional] Hosts the JS filters can call, like registry.example.com, *.example.com or localhost:5000. Any host if empty")
+	flags.String(jsHTTPCert, "", "[optional] Client certificate file of the HTTP calls of the JS filters")
+	flags.String(jsHTTPKey, "", "[optional] Client certificate key file of the HTTP calls of the JS filters")
+	flags.String(jsHTTPCA, "", "[optional] CA certificates file trusted by the HTTP calls of the JS filters, besides the system ones")
+	flags.Bool(jsCaptureConsole, false, "[optional] Sends the console output of the JS filters to the log, tagged with the filter and the request. Defaults to false")
+	flags.Bool(jsErrorDetails, true, "[optional] Sends the message, file and line of the JS filter errors to the clients. If false, the clients get a generic message and the details are only logged. Defaults to true")
+	flags.Int(jsHTTPRetries, 2, "[optional] How many times the idempotent HTTP calls of the JS filters are retried on network errors and 502, 503 or 504 statuses. Defaults to 2")
+	flags.String(storeBackend, "memory", "[optional] Backend of the store shared by the filters : memory, or bolt to keep the values across restarts. Defaults to memory")
+	flags.String(storePath, "", "[optional] File of the bolt store, created if missing")
 }
 
 // InitFromFilterBuilder initializes the web server builder with properties retrieved from Viper.
@@ -38,6 +89,23 @@ func (b *FilterBuilder) InitFromViper(v *viper.Viper) *FilterBuilder {
 	flags := new(FlagsFilter)
 	flags.JsFiltersPath = v.GetString(jsFiltersPath)
 	flags.GoPluginsPath = v.GetString(goPluginsPath)
+	flags.ProcessFiltersPath = v.GetString(processFiltersPath)
+	flags.FilterTraceHistory = v.GetInt(filterTraceHistory)
+	flags.JsEngine = v.GetString(jsEngine)
+	flags.JsVMPoolSize = v.GetInt(jsVMPoolSize)
+	flags.JsCPUBudget = v.GetInt(jsCPUBudget)
+	flags.JsMaxResultSize = v.GetInt(jsMaxResultSize)
+	flags.JsDeniedGlobals = v.GetStringSlice(jsDeniedGlobals)
+	flags.JsHTTPTimeout = v.GetInt(jsHTTPTimeout)
+	flags.JsHTTPAllowedHosts = v.GetStringSlice(jsHTTPAllowedHosts)
+	flags.JsHTTPCert = v.GetString(jsHTTPCert)
+	flags.JsHTTPKey = v.GetString(jsHTTPKey)
+	flags.JsHTTPCA = v.GetString(jsHTTPCA)
+	flags.JsHTTPRetries = v.GetInt(jsHTTPRetries)
+	flags.JsCaptureConsole = v.GetBool(jsCaptureConsole)
+	flags.JsErrorDetails = v.GetBool(jsErrorDetails)
+	flags.StoreBackend = v.GetString(storeBackend)
+	flags.StorePath = v.GetString(storePath)
 
 	flags.check()
 
@@ -0,0 +1,108 @@
+package docker
+
+import (
+	"context"
+	"errors"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// ErrNoClient returned by the calls made before the docker client is set
+var ErrNoClient = errors.New("the docker client is not available yet")
+
+var dockerCli *client.Client
+
+// SetClient sets the client used by the filters, the one go-horse uses to reach the daemon. The calls go straight
+// to the daemon socket, they don't go through the filters
+func SetClient(cli *client.Client) {
+	dockerCli = cli
+}
+
+// Client the client used by the filters, nil until go-horse sets it
+func Client() *client.Client {
+	return dockerCli
+}
+
+// IsNotFound tells if the error is a daemon not found error, like an unknown container id
+func IsNotFound(err error) bool {
+	return client.IsErrNotFound(err)
+}
+
+// Filters the list filters from a map, like {"label": ["team=ops"], "status": ["running"]}
+func Filters(values map[string][]string) filters.Args {
+	args := filters.NewArgs()
+	for key, list := range values {
+		for _, value := range list {
+			args.Add(key, value)
+		}
+	}
+	return args
+}
+
+// InspectContainer the container with the id or name
+func InspectContainer(ctx context.Context, id string) (types.ContainerJSON, error) {
+	if dockerCli == nil {
+		return types.ContainerJSON{}, ErrNoClient
+	}
+	return dockerCli.ContainerInspect(ctx, id)
+}
+
+// InspectImage the image with the id or reference
+func InspectImage(ctx context.Context, id string) (types.ImageInspect, error) {
+	if dockerCli == nil {
+		return types.ImageInspect{}, ErrNoClient
+	}
+	image, _, err := dockerCli.ImageInspectWithRaw(ctx, id)
+	return image, err
+}
+
+// InspectVolume the volume with the name
+func InspectVolume(ctx context.Context, name string) (types.Volume, error) {
+	if dockerCli == nil {
+		return types.Volume{}, ErrNoClient
+	}
+	return dockerCli.VolumeInspect(ctx, name)
+}
+
+// InspectNetwork the network with the id or name
+func InspectNetwork(ctx context.Context, id string) (types.NetworkResource, error) {
+	if dockerCli == nil {
+		return types.NetworkResource{}, ErrNoClient
+	}
+	return dockerCli.NetworkInspect(ctx, id, types.NetworkInspectOptions{})
+}
+
+// ListContainers the containers matching the filters, the stopped ones too when all is set
+func ListContainers(ctx context.Context, args filters.Args, all bool) ([]types.Container, error) {
+	if dockerCli == nil {
+		return nil, ErrNoClient
+	}
+	return dockerCli.ContainerList(ctx, types.ContainerListOptions{All: all, Filters: args})
+}
+
+// ListImages the images matching the filters
+func ListImages(ctx context.Context, args filters.Args) ([]types.ImageSummary, error) {
+	if dockerCli == nil {
+		return nil, ErrNoClient
+	}
+	return dockerCli.ImageList(ctx, types.ImageListOptions{Filters: args})
+}
+
+// ListVolumes the volumes matching the filters
+func ListVolumes(ctx context.Context, args filters.Args) ([]*types.Volume, error) {
+	if dockerCli == nil {
+		return nil, ErrNoClient
+	}
+	volumes, err := dockerCli.VolumeList(ctx, args)
+	return volumes.Volumes, err
+}
+
+// ListNetworks the networks matching the filters
+func ListNetworks(ctx context.Context, args filters.Args) ([]types.NetworkResource, error) {
+	if dockerCli == nil {
+		return nil, ErrNoClient
+	}
+	return dockerCli.NetworkList(ctx, types.NetworkListOptions{Filters: args})
+}
@@ -1,6 +1,10 @@
 package filtergo
 
 import (
+	"errors"
+	"fmt"
+
+	"github.com/labbsr0x/go-horse/filters/settings"
 	"github.com/labbsr0x/go-horse/filters/model"
 	"github.com/labbsr0x/go-horse/plugins"
 	"github.com/kataras/iris"
@@ -16,7 +20,7 @@ type FilterGO struct {
 
 // MatchURL go
 func (filterGo FilterGO) MatchURL(ctx iris.Context) bool {
-	return filterGo.Regex.MatchString(ctx.RequestPath(false))
+	return filterGo.Regex == nil || filterGo.Regex.MatchString(ctx.RequestPath(false))
 }
 
 // Config go
@@ -29,18 +33,96 @@ func (filterGo FilterGO) Exec(ctx iris.Context, requestBody string) (model.Filte
 	return filterGo.plugin.Exec(ctx, requestBody)
 }
 
-// NewFilterGO filter factory
-func NewFilterGO(plugin plugins.GoFilterDefinition) FilterGO {
+// errAbandoned returned when a plugin not implementing model.Cancelable is abandoned on cancel
+var errAbandoned = errors.New("filter abandoned, the plugin doesn't implement model.Cancelable")
+
+// pluginResult the result of a plugin run aside
+type pluginResult struct {
+	result   model.FilterReturn
+	err      error
+	panicked interface{}
+}
+
+// ExecCancelable go, the plugins implementing model.Cancelable are stopped when cancel is closed. The others are
+// abandoned : they keep running aside, their result and panics are only logged
+func (filterGo FilterGO) ExecCancelable(ctx iris.Context, requestBody string, cancel <-chan struct{}) (model.FilterReturn, error) {
+	if cancelable, ok := filterGo.plugin.(model.Cancelable); ok {
+		return cancelable.ExecCancelable(ctx, requestBody, cancel)
+	}
+	if cancel == nil {
+		return filterGo.plugin.Exec(ctx, requestBody)
+	}
+
+	done := make(chan pluginResult, 1)
+	abandoned := make(chan struct{})
+	go func() {
+		var run pluginResult
+		defer func() {
+			if run.panicked = recover(); run.panicked != nil {
+				select {
+				case <-abandoned:
+					logrus.WithFields(logrus.Fields{
+						"plugin_name": filterGo.Name,
+						"panic":       fmt.Sprintf("%v", run.panicked),
+					}).Errorf("Abandoned filter panicked - go filter exec")
+					return
+				default:
+				}
+			}
+			done <- run
+		}()
+		run.result, run.err = filterGo.plugin.Exec(ctx, requestBody)
+	}()
+
+	select {
+	case run := <-done:
+		if run.panicked != nil {
+			panic(run.panicked)
+		}
+		return run.result, run.err
+	case <-cancel:
+		close(abandoned)
+		logrus.WithFields(logrus.Fields{
+			"plugin_name": filterGo.Name,
+		}).Warnf("Filter abandoned while still running - go filter exec")
+		return model.FilterReturn{Next: false}, errAbandoned
+	}
+}
+
+// NewFilterGO filter factory, fails when the path pattern or the matchers of the plugin config don't compile
+func NewFilterGO(plugin plugins.GoFilterDefinition) (FilterGO, error) {
 	filterGo := FilterGO{}
 	filterGo.plugin = plugin
 	config := plugin.Config()
+	filterGo.FilterConfig = config
 	regex, err := regexp.Compile(config.PathPattern)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"plugin_name": config.Name,
-		}).Errorf("Error compiling the filter url matcher regex")
+		return filterGo, fmt.Errorf("invalid pathPattern : %v", err)
 	}
 	config.Regex = regex
+	if err := config.CheckFailurePolicy(); err != nil {
+		return filterGo, err
+	}
+	err = config.CompileMatchers()
 	filterGo.FilterConfig = config
-	return filterGo
+	return filterGo, err
+}
+
+// Configure reads the settings sidecar file of the plugin, shared by its versions, and hands them to the plugin when it is plugins.Configurable
+func (filterGo *FilterGO) Configure(file string) error {
+	values, settingsFile, err := settings.Load(plugins.SettingsFile(file))
+	if err != nil {
+		return fmt.Errorf("error reading the settings file %s : %v", settingsFile, err)
+	}
+	if values == nil {
+		values = make(map[string]interface{})
+	}
+	filterGo.File = file
+	filterGo.Settings = values
+	if configurable, ok := filterGo.plugin.(plugins.Configurable); ok {
+		if err := configurable.Configure(values); err != nil {
+			return fmt.Errorf("invalid settings : %v", err)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,48 @@
+package filtergo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kataras/iris"
+	"github.com/labbsr0x/go-horse/filters/model"
+)
+
+type hangingPlugin struct {
+	release chan struct{}
+}
+
+func (p hangingPlugin) Config() model.FilterConfig {
+	return model.FilterConfig{Name: "hanging", Timeout: 10 * time.Millisecond}
+}
+
+func (p hangingPlugin) Exec(ctx iris.Context, requestBody string) (model.FilterReturn, error) {
+	if requestBody == "panic" {
+		panic("boom")
+	}
+	<-p.release
+	return model.FilterReturn{Next: true}, nil
+}
+
+func TestExecCancelableAbandonsPlugins(t *testing.T) {
+	plugin := hangingPlugin{release: make(chan struct{})}
+	defer close(plugin.release)
+	filter, err := NewFilterGO(plugin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel := make(chan struct{})
+	time.AfterFunc(10*time.Millisecond, func() { close(cancel) })
+	result, err := filter.ExecCancelable(nil, "", cancel)
+	if err != errAbandoned || result.Next {
+		t.Fatalf("expected the plugin to be abandoned, got %+v and %v", result, err)
+	}
+
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Fatalf("expected the plugin panic, got %v", r)
+		}
+	}()
+	_, _ = filter.ExecCancelable(nil, "panic", make(chan struct{}))
+}
@@ -0,0 +1,136 @@
+package filterjs
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/labbsr0x/go-horse/filters/model"
+	"github.com/sirupsen/logrus"
+)
+
+// Encodings of ctx.rawBody
+const (
+	encodingText   = "text"
+	encodingBase64 = "base64"
+)
+
+// bodyInfo what the filters know about the body they get, as ctx.bodyInfo
+type bodyInfo struct {
+	Size        int    `json:"size"`
+	ContentType string `json:"contentType"`
+	MediaType   string `json:"mediaType"`
+	Charset     string `json:"charset,omitempty"`
+	// Encoding of ctx.rawBody : text, or base64 for the binary bodies
+	Encoding string `json:"encoding"`
+	JSON     bool   `json:"json"`
+	Form     bool   `json:"form"`
+	Binary   bool   `json:"binary"`
+}
+
+// newBodyInfo inspects the body and its content type. Bodies without a textual media type are binary when they are
+// not valid UTF-8, like the tar archives of the build contexts
+func newBodyInfo(contentType string, body string) bodyInfo {
+	info := bodyInfo{Size: len(body), ContentType: contentType, Encoding: encodingText}
+	if mediaType, params, err := mime.ParseMediaType(contentType); err == nil {
+		info.MediaType = mediaType
+		info.Charset = params["charset"]
+	}
+	info.JSON = info.MediaType == "application/json" || strings.HasSuffix(info.MediaType, "+json")
+	info.Form = info.MediaType == "application/x-www-form-urlencoded"
+	if !info.JSON && !info.Form && !textualMediaType(info.MediaType) {
+		info.Binary = binaryMediaType(info.MediaType) || !utf8.ValidString(body) || strings.ContainsRune(body, 0)
+	}
+	if info.Binary {
+		info.Encoding = encodingBase64
+	}
+	return info
+}
+
+func textualMediaType(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "+xml") || mediaType == "application/xml" ||
+		mediaType == "application/javascript" || mediaType == "application/yaml" || mediaType == "application/x-yaml"
+}
+
+func binaryMediaType(mediaType string) bool {
+	for _, prefix := range []string{"image/", "audio/", "video/", "application/octet-stream", "application/x-tar", "application/tar",
+		"application/gzip", "application/x-gzip", "application/zip", "application/x-bzip2", "application/x-xz"} {
+		if strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// rawBody the body as ctx.rawBody, base64 encoded when binary
+func (info bodyInfo) rawBody(body string) string {
+	if info.Binary {
+		return base64.StdEncoding.EncodeToString([]byte(body))
+	}
+	return body
+}
+
+// form the fields of a form body, as ctx.form, nil for other bodies
+func (info bodyInfo) form(body string) map[string][]string {
+	if !info.Form {
+		return nil
+	}
+	values, err := url.ParseQuery(body)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Errorf("Error parsing the form body - js filter exec")
+	}
+	return values
+}
+
+// json ctx.bodyInfo encoded as JSON
+func (info bodyInfo) json() string {
+	encoded, _ := json.Marshal(info)
+	return string(encoded)
+}
+
+// returnedBody the body properties of a filter return
+type returnedBody struct {
+	// encoded the body property encoded as JSON
+	encoded string
+	// text the body property when it is a string
+	text   string
+	isText bool
+	// raw the rawBody property, base64 encoded for the binary bodies
+	raw    string
+	hasRaw bool
+}
+
+// replacement the body replacing the original one. A rawBody replaces any body. Otherwise JSON bodies are replaced by
+// the JSON encoding of the returned body and text bodies by the returned string. Binary bodies are only replaced by a
+// rawBody, a WRITE without one is turned into a READ, the body is never replaced by an encoded object
+func (info bodyInfo) replacement(filterName string, operation model.BodyOperation, returned returnedBody) (string, model.BodyOperation, error) {
+	if returned.hasRaw {
+		if !info.Binary {
+			return returned.raw, operation, nil
+		}
+		decoded, err := base64.StdEncoding.DecodeString(returned.raw)
+		if err != nil {
+			return "", operation, fmt.Errorf("the rawBody of a binary body must be base64 encoded : %v", err)
+		}
+		return string(decoded), operation, nil
+	}
+	if info.Binary {
+		if operation == model.Write {
+			logrus.WithFields(logrus.Fields{
+				"plugin_name": filterName,
+				"media_type":  info.MediaType,
+			}).Warnf("Binary body kept, return a base64 rawBody to replace it - js filter exec")
+		}
+		return returned.encoded, model.Read, nil
+	}
+	if !info.JSON && info.MediaType != "" && returned.isText {
+		return returned.text, operation, nil
+	}
+	return returned.encoded, operation, nil
+}
@@ -0,0 +1,139 @@
+package filterjs
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/labbsr0x/go-horse/filters/jwt"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// cryptoError name of the error thrown by the failed ctx.crypto calls
+	cryptoError = "CryptoError"
+	// jwtError name of the error thrown by ctx.jwt.verify for the rejected tokens
+	jwtError = "JWTError"
+	// maxRandomBytes maximum size of ctx.crypto.randomBytes
+	maxRandomBytes = 1024
+)
+
+// cryptoFunctions the functions of the ctx.crypto object. Strings are hashed and encoded as UTF-8, the binary results
+// are returned as hex, base64 or base64url strings, hex by default
+func cryptoFunctions() map[string]nativeFunction {
+	result := func(name string, data []byte, encoding interface{}) (interface{}, error) {
+		encoded, err := encodeBytes(data, encoding)
+		if err != nil {
+			return nil, throw(cryptoError, "%s : %v", name, err)
+		}
+		return encoded, nil
+	}
+	return map[string]nativeFunction{
+		"sha256": func(call nativeCall) (interface{}, error) {
+			digest := sha256.Sum256([]byte(call.String(0)))
+			return result("sha256", digest[:], call.Argument(1))
+		},
+		"hmacSha256": func(call nativeCall) (interface{}, error) {
+			mac := hmac.New(sha256.New, []byte(call.String(0)))
+			mac.Write([]byte(call.String(1)))
+			return result("hmacSha256", mac.Sum(nil), call.Argument(2))
+		},
+		"randomBytes": func(call nativeCall) (interface{}, error) {
+			size, _ := toFloat(call.Argument(0))
+			if size < 1 || size > maxRandomBytes {
+				return nil, throw(cryptoError, "randomBytes : size must be between 1 and %d", maxRandomBytes)
+			}
+			data := make([]byte, int(size))
+			if _, err := rand.Read(data); err != nil {
+				return nil, throw(cryptoError, "randomBytes : %v", err)
+			}
+			return result("randomBytes", data, call.Argument(1))
+		},
+		"equal": func(call nativeCall) (interface{}, error) {
+			return subtle.ConstantTimeCompare([]byte(call.String(0)), []byte(call.String(1))) == 1, nil
+		},
+		"base64Encode": func(call nativeCall) (interface{}, error) {
+			return base64.StdEncoding.EncodeToString([]byte(call.String(0))), nil
+		},
+		"base64Decode": func(call nativeCall) (interface{}, error) {
+			decoded, err := base64.StdEncoding.DecodeString(call.String(0))
+			if err != nil {
+				return nil, throw(cryptoError, "base64Decode : %v", err)
+			}
+			return string(decoded), nil
+		},
+		"base64urlEncode": func(call nativeCall) (interface{}, error) {
+			return base64.RawURLEncoding.EncodeToString([]byte(call.String(0))), nil
+		},
+		"base64urlDecode": func(call nativeCall) (interface{}, error) {
+			decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(call.String(0), "="))
+			if err != nil {
+				return nil, throw(cryptoError, "base64urlDecode : %v", err)
+			}
+			return string(decoded), nil
+		},
+	}
+}
+
+// encodeBytes the bytes as a hex, base64 or base64url string, hex if the encoding is not set
+func encodeBytes(data []byte, encoding interface{}) (string, error) {
+	name := "hex"
+	if encoding != nil {
+		name = fmt.Sprint(encoding)
+	}
+	switch name {
+	case "hex":
+		return hex.EncodeToString(data), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString(data), nil
+	case "base64url":
+		return base64.RawURLEncoding.EncodeToString(data), nil
+	}
+	return "", fmt.Errorf("unknown encoding %q, expected hex, base64 or base64url", name)
+}
+
+// jwtFunctions the functions of the ctx.jwt object. Relative JWKS files are read from the filters directory
+func jwtFunctions(filtersDir string) map[string]nativeFunction {
+	return map[string]nativeFunction{
+		"verify": func(call nativeCall) (interface{}, error) {
+			values := call.Object(1)
+			options := jwt.Options{
+				JWKSFile:   stringOption(values, "jwksFile"),
+				Secret:     stringOption(values, "secret"),
+				Issuer:     stringOption(values, "issuer"),
+				Audience:   stringOption(values, "audience"),
+				Algorithms: toStringList(values["algorithms"]),
+			}
+			if options.JWKSFile != "" && !filepath.IsAbs(options.JWKSFile) {
+				options.JWKSFile = filepath.Join(filtersDir, options.JWKSFile)
+			}
+			if leeway, ok := toFloat(values["leeway"]); ok {
+				options.Leeway = time.Duration(leeway * float64(time.Second))
+			}
+			claims, err := jwt.Verify(call.String(0), options)
+			if err != nil {
+				if _, rejected := err.(*jwt.ValidationError); !rejected {
+					logrus.WithFields(logrus.Fields{
+						"error": err.Error(),
+					}).Errorf("Error verifying a token - js filter jwt")
+				}
+				return nil, throw(jwtError, "%v", err)
+			}
+			return claims, nil
+		},
+	}
+}
+
+func stringOption(values map[string]interface{}, name string) string {
+	if value, ok := values[name].(string); ok {
+		return value
+	}
+	return ""
+}
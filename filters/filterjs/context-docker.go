@@ -0,0 +1,90 @@
+package filterjs
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/labbsr0x/go-horse/filters/docker"
+	"github.com/sirupsen/logrus"
+)
+
+// dockerCallTimeout maximum time of a ctx.docker call
+const dockerCallTimeout = 30 * time.Second
+
+// dockerError name of the error thrown by the failed ctx.docker calls
+const dockerError = "DockerError"
+
+// dockerFunctions the functions of the ctx.docker object, their calls are canceled with parent. Inspecting an unknown
+// object returns null, other daemon errors throw a DockerError
+func dockerFunctions(parent context.Context) map[string]nativeFunction {
+	inspect := func(name string, do func(ctx context.Context, id string) (interface{}, error)) nativeFunction {
+		return func(call nativeCall) (interface{}, error) {
+			id := call.String(0)
+			return dockerCall(parent, name, func(ctx context.Context) (interface{}, error) { return do(ctx, id) })
+		}
+	}
+	list := func(name string, do func(ctx context.Context, call nativeCall) (interface{}, error)) nativeFunction {
+		return func(call nativeCall) (interface{}, error) {
+			return dockerCall(parent, name, func(ctx context.Context) (interface{}, error) { return do(ctx, call) })
+		}
+	}
+	return map[string]nativeFunction{
+		"inspectContainer": inspect("inspectContainer", func(ctx context.Context, id string) (interface{}, error) {
+			return docker.InspectContainer(ctx, id)
+		}),
+		"inspectImage": inspect("inspectImage", func(ctx context.Context, id string) (interface{}, error) {
+			return docker.InspectImage(ctx, id)
+		}),
+		"inspectVolume": inspect("inspectVolume", func(ctx context.Context, id string) (interface{}, error) {
+			return docker.InspectVolume(ctx, id)
+		}),
+		"inspectNetwork": inspect("inspectNetwork", func(ctx context.Context, id string) (interface{}, error) {
+			return docker.InspectNetwork(ctx, id)
+		}),
+		"listContainers": list("listContainers", func(ctx context.Context, call nativeCall) (interface{}, error) {
+			all, _ := call.Argument(1).(bool)
+			return docker.ListContainers(ctx, docker.Filters(dockerFilters(call.Object(0))), all)
+		}),
+		"listImages": list("listImages", func(ctx context.Context, call nativeCall) (interface{}, error) {
+			return docker.ListImages(ctx, docker.Filters(dockerFilters(call.Object(0))))
+		}),
+		"listVolumes": list("listVolumes", func(ctx context.Context, call nativeCall) (interface{}, error) {
+			return docker.ListVolumes(ctx, docker.Filters(dockerFilters(call.Object(0))))
+		}),
+		"listNetworks": list("listNetworks", func(ctx context.Context, call nativeCall) (interface{}, error) {
+			return docker.ListNetworks(ctx, docker.Filters(dockerFilters(call.Object(0))))
+		}),
+	}
+}
+
+// dockerCall runs the daemon call and returns its result, encoded to a JS object with the daemon API field names
+func dockerCall(parent context.Context, name string, do func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(parent, dockerCallTimeout)
+	defer cancel()
+	result, err := do(ctx)
+	if err != nil {
+		if docker.IsNotFound(err) {
+			return nil, nil
+		}
+		logrus.WithFields(logrus.Fields{
+			"call":  name,
+			"error": err.Error(),
+		}).Errorf("Error calling the docker daemon - js filter docker")
+		return nil, throw(dockerError, "%s : %v", name, err)
+	}
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return nil, throw(dockerError, "%s : error encoding the result : %v", name, err)
+	}
+	return json.RawMessage(encoded), nil
+}
+
+// dockerFilters the list filters of a JS object, like {label: ["team=ops"], status: "running"}
+func dockerFilters(object map[string]interface{}) map[string][]string {
+	values := make(map[string][]string)
+	for key, item := range object {
+		values[key] = toStringList(item)
+	}
+	return values
+}
@@ -0,0 +1,94 @@
+package filterjs
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/kataras/iris"
+	"github.com/labbsr0x/go-horse/filters/trace"
+	"github.com/sirupsen/logrus"
+)
+
+// logLevels the ctx.log functions and their log level
+var logLevels = map[string]logrus.Level{
+	"debug": logrus.DebugLevel,
+	"info":  logrus.InfoLevel,
+	"warn":  logrus.WarnLevel,
+	"error": logrus.ErrorLevel,
+}
+
+// consoleLevels the captured console functions and their log level
+var consoleLevels = map[string]logrus.Level{
+	"log":   logrus.InfoLevel,
+	"info":  logrus.InfoLevel,
+	"debug": logrus.DebugLevel,
+	"trace": logrus.TraceLevel,
+	"warn":  logrus.WarnLevel,
+	"error": logrus.ErrorLevel,
+}
+
+// logger the log entry of a filter execution, tagged with the filter, the invoke phase, the request path and the
+// request id, the one of the filter trace
+func (filterJs FilterJS) logger(ctx iris.Context) *logrus.Entry {
+	fields := logrus.Fields{
+		"filter": filterJs.Name,
+		"invoke": filterJs.InvokeName(),
+		"path":   ctx.Request().URL.Path,
+	}
+	if requestTrace, ok := ctx.Values().Get(trace.Key).(*trace.Trace); ok {
+		fields["request_id"] = requestTrace.ID
+	}
+	return logrus.WithFields(fields)
+}
+
+// logFunctions the functions of the ctx.log object : level(message, fields)
+func logFunctions(logger *logrus.Entry) map[string]nativeFunction {
+	functions := make(map[string]nativeFunction)
+	for name, level := range logLevels {
+		level := level
+		functions[name] = func(call nativeCall) (interface{}, error) {
+			entry := logger
+			if fields := call.Object(1); fields != nil {
+				// the filter fields go first, the tags of the filter execution can't be overwritten
+				entry = logger.Logger.WithFields(logrus.Fields(fields)).WithFields(logger.Data)
+			}
+			entry.Log(level, call.String(0))
+			return undefined, nil
+		}
+	}
+	return functions
+}
+
+// consoleFunctions the functions of the console object. Captured, the output goes to the log like ctx.log, otherwise
+// to the standard output, as the otto console does
+func consoleFunctions(logger *logrus.Entry, capture bool) map[string]nativeFunction {
+	functions := make(map[string]nativeFunction)
+	for name, level := range consoleLevels {
+		level := level
+		functions[name] = func(call nativeCall) (interface{}, error) {
+			message := consoleMessage(call)
+			if capture {
+				logger.WithField("console", true).Log(level, message)
+			} else {
+				fmt.Println(message)
+			}
+			return undefined, nil
+		}
+	}
+	return functions
+}
+
+// consoleMessage the console arguments separated by spaces, objects as JSON
+func consoleMessage(call nativeCall) string {
+	parts := make([]string, len(call.arguments))
+	for i, argument := range call.arguments {
+		parts[i] = call.String(i)
+		if call.plainObject(i) {
+			if encoded, err := json.Marshal(argument); err == nil {
+				parts[i] = string(encoded)
+			}
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,58 @@
+package filterjs
+
+import (
+	"time"
+
+	"github.com/labbsr0x/go-horse/filters/store"
+)
+
+// storeError name of the error thrown by the failed ctx.store calls
+const storeError = "StoreError"
+
+// storeFunctions the functions of the ctx.store object. TTLs are in milliseconds, values without a TTL never expire
+func storeFunctions() map[string]nativeFunction {
+	return map[string]nativeFunction{
+		"get": func(call nativeCall) (interface{}, error) {
+			value, found, err := store.Get(call.String(0))
+			if err != nil {
+				return nil, throw(storeError, "get : %v", err)
+			}
+			if !found {
+				return undefined, nil
+			}
+			return value, nil
+		},
+		"set": func(call nativeCall) (interface{}, error) {
+			if err := store.Set(call.String(0), call.Argument(1), storeTTL(call.Argument(2))); err != nil {
+				return nil, throw(storeError, "set : %v", err)
+			}
+			return undefined, nil
+		},
+		"delete": func(call nativeCall) (interface{}, error) {
+			if err := store.Delete(call.String(0)); err != nil {
+				return nil, throw(storeError, "delete : %v", err)
+			}
+			return undefined, nil
+		},
+		"incr": func(call nativeCall) (interface{}, error) {
+			delta := 1.0
+			if call.Defined(1) {
+				delta, _ = toFloat(call.Argument(1))
+			}
+			number, err := store.Incr(call.String(0), delta, storeTTL(call.Argument(2)))
+			if err != nil {
+				return nil, throw(storeError, "incr : %v", err)
+			}
+			return number, nil
+		},
+	}
+}
+
+// storeTTL the TTL argument in milliseconds, zero if not set
+func storeTTL(value interface{}) time.Duration {
+	ttl, ok := toFloat(value)
+	if !ok {
+		return 0
+	}
+	return time.Duration(ttl) * time.Millisecond
+}
@@ -1,53 +1,31 @@
 package filterjs
 
 import (
-	"github.com/labbsr0x/go-horse/util"
 	"github.com/kataras/iris"
-	"github.com/robertkrimen/otto"
-	"github.com/sirupsen/logrus"
+	"github.com/labbsr0x/go-horse/util"
 )
 
-func requestScopeGetToJSContext(ctx iris.Context, call otto.FunctionCall) otto.Value {
-	key, err := call.Argument(0).ToString()
-	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"error": err.Error(),
-		}).Errorf("Error parsing requestScopeGetToJSContext key field - js filter exec")
-	}
-	value := util.RequestScopeGet(ctx, key)
-	result, err := otto.ToValue(value)
-	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"error": err.Error(),
-		}).Errorf("Error parsing requestScopeGetToJSContext function return - js filter exec")
-	}
-	return result
-}
-
-func requestScopeSetToJSContext(ctx iris.Context, call otto.FunctionCall) otto.Value {
-	key, err := call.Argument(0).ToString()
-	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"error": err.Error(),
-		}).Errorf("Error parsing requestScopeSetToJSContext key field - js filter exec")
-	}
-	value, err := call.Argument(1).ToString()
-	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"error": err.Error(),
-		}).Errorf("Error parsing requestScopeSetToJSContext function exec - js filter exec")
-	}
-	util.RequestScopeSet(ctx, key, value)
-	return otto.NullValue()
-}
+// valuesError name of the error thrown by ctx.values.set when a value can't be set
+const valuesError = "ValueError"
 
-func requestScopeListToJSContext(ctx iris.Context, call otto.FunctionCall) otto.Value {
-	mapa := util.RequestScopeList(ctx)
-	result, err := call.Otto.ToValue(mapa)
-	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"error": err.Error(),
-		}).Errorf("Error parsing requestScopeListToJSContext response map - js filter exec")
+// valuesFunctions the functions of the ctx.values object, the values of the request scope
+func valuesFunctions(ctx iris.Context) map[string]nativeFunction {
+	return map[string]nativeFunction{
+		"get": func(call nativeCall) (interface{}, error) {
+			value, ok := util.RequestScopeValue(ctx, call.String(0))
+			if !ok {
+				return undefined, nil
+			}
+			return value, nil
+		},
+		"set": func(call nativeCall) (interface{}, error) {
+			if err := util.RequestScopeSet(ctx, call.String(0), call.Argument(1)); err != nil {
+				return nil, throw(valuesError, "%v", err)
+			}
+			return nil, nil
+		},
+		"list": func(call nativeCall) (interface{}, error) {
+			return util.RequestScopeValues(ctx), nil
+		},
 	}
-	return result
 }
@@ -0,0 +1,339 @@
+package filterjs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/kataras/iris"
+	"github.com/labbsr0x/go-horse/dockerapi"
+	"github.com/labbsr0x/go-horse/filters/model"
+	"github.com/labbsr0x/go-horse/plugins"
+	"github.com/labbsr0x/go-horse/util"
+	"github.com/robertkrimen/otto"
+	"github.com/sirupsen/logrus"
+)
+
+var gojaResetProgram = goja.MustCompile("reset", resetSource, false)
+
+// gojaVM a goja (ES2015+) VM. The ctx functions are the native functions shared with otto, so filters get the same
+// ctx and plugins contract on both engines
+type gojaVM struct {
+	runtime   *goja.Runtime
+	function  goja.Callable
+	resetFunc goja.Callable
+	parse     goja.Callable
+	stringify goja.Callable
+	// plugins VM converting the values of the Go plugins written for otto, created on their first call
+	plugins *otto.Otto
+}
+
+// newGojaFactory compiles the filter function once and returns the factory of the VMs evaluating it
+func newGojaFactory(filterConfig model.FilterConfig, options Options) (func() (vm, error), error) {
+	program, err := goja.Compile(filterConfig.File, "("+filterConfig.Function+")", false)
+	if err != nil {
+		return nil, err
+	}
+	return func() (vm, error) {
+		runtime := goja.New()
+		v := &gojaVM{runtime: runtime}
+		json := runtime.Get("JSON").ToObject(runtime)
+		v.parse, _ = goja.AssertFunction(json.Get("parse"))
+		v.stringify, _ = goja.AssertFunction(json.Get("stringify"))
+		if err := options.Library.gojaRequire(runtime); err != nil {
+			return nil, err
+		}
+		if err := v.denyGlobals(filterConfig.Name, options.DeniedGlobals); err != nil {
+			return nil, err
+		}
+		function, err := runtime.RunProgram(program)
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		if v.function, ok = goja.AssertFunction(function); !ok {
+			return nil, fmt.Errorf("the filter function is not a function : %v", function)
+		}
+		resetFunc, err := runtime.RunProgram(gojaResetProgram)
+		if err != nil {
+			return nil, err
+		}
+		v.resetFunc, _ = goja.AssertFunction(resetFunc)
+		return v, nil
+	}, nil
+}
+
+// denyGlobals replaces the denied globals by a function throwing an error naming the filter
+func (v *gojaVM) denyGlobals(filterName string, names []string) error {
+	for _, name := range names {
+		if ProtectedGlobals[name] {
+			continue
+		}
+		message := deniedGlobalMessage(name, filterName)
+		denied := func(call goja.FunctionCall) goja.Value {
+			panic(v.newError(deniedGlobalError, message))
+		}
+		if err := v.runtime.Set(name, denied); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newError a JS error object with a custom name
+func (v *gojaVM) newError(name, message string) *goja.Object {
+	errorObj, err := v.runtime.New(v.runtime.Get("Error"), v.runtime.ToValue(message))
+	if err != nil {
+		panic(err)
+	}
+	_ = errorObj.Set("name", name)
+	return errorObj
+}
+
+func (v *gojaVM) exec(filterJs FilterJS, ctx iris.Context, body string, execution *execution) (model.FilterReturn, error) {
+	runtime := v.runtime
+
+	var bodyParsed goja.Value = runtime.NewObject()
+	var contentType string
+	var headers http.Header
+	if filterJs.Invoke == model.Request {
+		contentType = ctx.Request().Header.Get("Content-Type")
+		headers = ctx.Request().Header
+	} else {
+		contentType = ctx.ResponseWriter().Header().Get("Content-Type")
+		headers = ctx.ResponseWriter().Header()
+	}
+
+	info := newBodyInfo(contentType, body)
+	rawBody := info.rawBody(body)
+	if info.JSON {
+		if body == "" {
+			body = "{}"
+		}
+		if parsed, err := v.parse(goja.Undefined(), runtime.ToValue(body)); err == nil {
+			bodyParsed = parsed
+		} else {
+			logrus.WithFields(logrus.Fields{
+				"plugin_name": filterJs.Name,
+			}).Errorf("Error parsing body string to JS object - js filter exec")
+		}
+	}
+
+	operation := runtime.NewObject()
+	_ = operation.Set("READ", int(model.Read))
+	_ = operation.Set("WRITE", int(model.Write))
+
+	// goja has no console, it is set on each execution, writing to the standard output as otto does unless captured
+	consoleJsObj := runtime.NewObject()
+	for name, function := range consoleFunctions(execution.logger, filterJs.options.CaptureConsole) {
+		_ = consoleJsObj.Set(name, v.native(function))
+	}
+	_ = runtime.Set("console", consoleJsObj)
+
+	dockerOperation := dockerapi.FromContext(ctx)
+	pathParams := make(map[string]interface{})
+	for key, value := range dockerOperation.Params {
+		pathParams[key] = value
+	}
+
+	ctxJsObj := runtime.NewObject()
+	for object, functions := range filterJs.nativeFunctions(ctx, execution) {
+		jsObj := runtime.NewObject()
+		for name, function := range functions {
+			_ = jsObj.Set(name, v.native(function))
+		}
+		_ = ctxJsObj.Set(object, jsObj)
+	}
+	_ = ctxJsObj.Set("url", ctx.Request().URL.Path)
+	_ = ctxJsObj.Set("body", bodyParsed)
+	_ = ctxJsObj.Set("rawBody", rawBody)
+	if bodyInfoJsObj, err := v.parse(goja.Undefined(), runtime.ToValue(info.json())); err == nil {
+		freeze, _ := goja.AssertFunction(runtime.Get("Object").ToObject(runtime).Get("freeze"))
+		_, _ = freeze(goja.Undefined(), bodyInfoJsObj)
+		_ = ctxJsObj.Set("bodyInfo", bodyInfoJsObj)
+	}
+	if form := info.form(rawBody); form != nil {
+		_ = ctxJsObj.Set("form", form)
+	}
+	_ = ctxJsObj.Set("operation", operation)
+	_ = ctxJsObj.Set("method", strings.ToUpper(ctx.Method()))
+	// a plain map, goja would expose http.Header methods instead of its keys
+	_ = ctxJsObj.Set("headers", map[string][]string(headers))
+	_ = ctxJsObj.Set("request", v.native(execution.native(filterJs.options.HTTP.legacyRequest(execution.context))))
+	_ = ctxJsObj.Set("responseStatusCode", ctx.Values().GetString(util.ResponseStatusCodeKey))
+	_ = ctxJsObj.Set("operationId", dockerOperation.ID)
+	_ = ctxJsObj.Set("apiVersion", dockerOperation.Version)
+	_ = ctxJsObj.Set("pathParams", pathParams)
+
+	if config, err := v.parse(goja.Undefined(), runtime.ToValue(filterJs.settingsJSON)); err == nil {
+		_ = ctxJsObj.Set("config", config)
+	} else {
+		logrus.WithFields(logrus.Fields{
+			"plugin_name": filterJs.Name,
+			"error":       err.Error(),
+		}).Errorf("Error parsing the filter settings to JS object - js filter exec")
+	}
+
+	pluginsJsObj := runtime.NewObject()
+	for _, jsPlugin := range plugins.JSPluginList {
+		function := v.ottoPlugin(ctx, jsPlugin)
+		if native, ok := jsPlugin.(plugins.JSNativeInjection); ok {
+			function = nativePlugin(ctx, native)
+		}
+		err := pluginsJsObj.Set(jsPlugin.Name(), v.native(execution.native(function)))
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"plugin_name": jsPlugin.Name(),
+			}).Errorf("Error on applying GO->JS plugin - js filter exec")
+		}
+	}
+
+	returnValue, err := v.function(goja.Undefined(), ctxJsObj, pluginsJsObj)
+	if err != nil {
+		if interrupted, ok := err.(*goja.InterruptedError); ok {
+			if err := interruptError(interrupted.Value()); err != nil {
+				return model.FilterReturn{Next: false}, err
+			}
+		}
+		scriptErr := filterJs.scriptError(err)
+		logScriptError(scriptErr)
+		return model.FilterReturn{Next: false, Body: errorBody(scriptErr.Error())}, scriptErr
+	}
+	result, ok := returnValue.(*goja.Object)
+	if !ok {
+		return errorReturnFilter(errors.New("the filter function must return an object"))
+	}
+	jsFunctionReturn := model.FilterReturn{}
+
+	jsFunctionReturn.Next = property(result, "next").ToBoolean()
+
+	returned := returnedBody{}
+	bodyValue := property(result, "body")
+	serialized, err := v.stringify(goja.Undefined(), bodyValue)
+	if err != nil {
+		return errorReturnFilter(err)
+	}
+	returned.encoded = serialized.String()
+	_, returned.isText = bodyValue.Export().(string)
+	returned.text = bodyValue.String()
+	if value := property(result, "rawBody"); isDefined(value) {
+		returned.raw, returned.hasRaw = value.String(), true
+	}
+
+	jsFunctionReturn.Operation = model.BodyOperation(property(result, "operation").ToInteger())
+	if jsFunctionReturn.Body, jsFunctionReturn.Operation, err = info.replacement(filterJs.Name, jsFunctionReturn.Operation, returned); err != nil {
+		return errorReturnFilter(err)
+	}
+	if err := filterJs.checkResultSize("body", jsFunctionReturn.Body); err != nil {
+		return model.FilterReturn{Next: false}, err
+	}
+	jsFunctionReturn.Status = int(property(result, "status").ToInteger())
+
+	if value := property(result, "error"); isDefined(value) {
+		jsFunctionReturn.Err = errors.New(value.String())
+	}
+
+	if value := property(result, "headers"); isDefined(value) {
+		headers, err := v.headerOperations(value)
+		if err != nil {
+			return errorReturnFilter(err)
+		}
+		jsFunctionReturn.Headers = headers
+	}
+
+	if value := property(result, "response"); isDefined(value) {
+		response, err := v.syntheticResponse(value)
+		if err != nil {
+			return errorReturnFilter(err)
+		}
+		if err := filterJs.checkResultSize("response body", response.Body); err != nil {
+			return model.FilterReturn{Next: false}, err
+		}
+		jsFunctionReturn.Response = response
+	}
+
+	return jsFunctionReturn, jsFunctionReturn.Err
+}
+
+// property an object property, undefined if missing
+func property(object *goja.Object, name string) goja.Value {
+	if value := object.Get(name); value != nil {
+		return value
+	}
+	return goja.Undefined()
+}
+
+// headerOperations reads the {set: {name: value}, remove: [name]} headers property of the filter return
+func (v *gojaVM) headerOperations(value goja.Value) (model.HeaderOperations, error) {
+	headers := model.HeaderOperations{}
+	if _, ok := value.Export().(map[string]interface{}); !ok {
+		return headers, fmt.Errorf("expected headers to be an object like {set: {}, remove: []}, got %v", value)
+	}
+	object := value.ToObject(v.runtime)
+	var err error
+	if set := property(object, "set"); isDefined(set) {
+		if headers.Set, err = definitionStringMap(set); err != nil {
+			return headers, err
+		}
+	}
+	if remove := property(object, "remove"); isDefined(remove) {
+		if headers.Remove, err = definitionStringList(remove); err != nil {
+			return headers, err
+		}
+	}
+	return headers, nil
+}
+
+// syntheticResponse reads the {status, headers, contentType, body} response property of the filter return.
+// A body other than a string is serialized as JSON
+func (v *gojaVM) syntheticResponse(value goja.Value) (*model.SyntheticResponse, error) {
+	if _, ok := value.Export().(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("expected response to be an object like {status, headers, contentType, body}, got %v", value)
+	}
+	object := value.ToObject(v.runtime)
+	response := &model.SyntheticResponse{}
+	if status := property(object, "status"); isDefined(status) {
+		response.Status = int(status.ToInteger())
+	}
+	if err := response.CheckStatus(); err != nil {
+		return nil, err
+	}
+	if headers := property(object, "headers"); isDefined(headers) {
+		var err error
+		if response.Headers, err = definitionStringMap(headers); err != nil {
+			return nil, err
+		}
+	}
+	if contentType := property(object, "contentType"); isDefined(contentType) {
+		response.ContentType = contentType.String()
+	}
+	if body := property(object, "body"); isDefined(body) {
+		if str, ok := body.Export().(string); ok {
+			response.Body = str
+		} else {
+			serialized, err := v.stringify(goja.Undefined(), body)
+			if err != nil {
+				return nil, err
+			}
+			response.Body = serialized.String()
+		}
+	}
+	return response, nil
+}
+
+func (v *gojaVM) interrupt(sentinel interface{}) {
+	v.runtime.Interrupt(sentinel)
+}
+
+func (v *gojaVM) clearInterrupt() {
+	v.runtime.ClearInterrupt()
+}
+
+func (v *gojaVM) reset() error {
+	if _, err := v.resetFunc(goja.Undefined()); err != nil {
+		return fmt.Errorf("error resetting the VM globals : %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package filterjs
+
+import (
+	"fmt"
+
+	"github.com/kataras/iris"
+	"github.com/labbsr0x/go-horse/filters/model"
+	"github.com/robertkrimen/otto"
+)
+
+var ottoResetScript = mustCompileOtto("reset", resetSource)
+
+func mustCompileOtto(fileName, src string) *otto.Script {
+	script, err := otto.New().Compile(fileName, src)
+	if err != nil {
+		panic(err)
+	}
+	return script
+}
+
+// ottoVM an otto (ES5) VM
+type ottoVM struct {
+	js        *otto.Otto
+	function  otto.Value
+	resetFunc otto.Value
+}
+
+// newOttoFactory compiles the filter function once and returns the factory of the VMs evaluating it
+func newOttoFactory(filterConfig model.FilterConfig, options Options) (func() (vm, error), error) {
+	script, err := otto.New().Compile(filterConfig.File, "("+filterConfig.Function+")")
+	if err != nil {
+		return nil, err
+	}
+	return func() (vm, error) {
+		js := otto.New()
+		if err := options.Library.ottoRequire(js); err != nil {
+			return nil, err
+		}
+		if err := denyOttoGlobals(js, filterConfig.Name, options.DeniedGlobals); err != nil {
+			return nil, err
+		}
+		function, err := js.Run(script)
+		if err != nil {
+			return nil, err
+		}
+		resetFunc, err := js.Run(ottoResetScript)
+		if err != nil {
+			return nil, err
+		}
+		// checked by otto on every statement, filled by interrupt
+		js.Interrupt = make(chan func(), 1)
+		return &ottoVM{js: js, function: function, resetFunc: resetFunc}, nil
+	}, nil
+}
+
+// denyOttoGlobals replaces the denied globals by a function throwing an error naming the filter
+func denyOttoGlobals(js *otto.Otto, filterName string, names []string) error {
+	for _, name := range names {
+		if ProtectedGlobals[name] {
+			continue
+		}
+		message := deniedGlobalMessage(name, filterName)
+		denied := func(call otto.FunctionCall) otto.Value {
+			panic(call.Otto.MakeCustomError(deniedGlobalError, message))
+		}
+		if err := js.Set(name, denied); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *ottoVM) exec(filterJs FilterJS, ctx iris.Context, body string, execution *execution) (result model.FilterReturn, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			interrupted := interruptError(r)
+			if interrupted == nil {
+				panic(r)
+			}
+			result, err = model.FilterReturn{Next: false}, interrupted
+		}
+	}()
+	return filterJs.execOtto(ctx, v.js, v.function, body, execution)
+}
+
+func (v *ottoVM) interrupt(sentinel interface{}) {
+	select {
+	case v.js.Interrupt <- func() { panic(sentinel) }:
+	default:
+	}
+}
+
+func (v *ottoVM) clearInterrupt() {
+	select {
+	case <-v.js.Interrupt:
+	default:
+	}
+}
+
+func (v *ottoVM) reset() error {
+	if _, err := v.resetFunc.Call(otto.UndefinedValue()); err != nil {
+		return fmt.Errorf("error resetting the VM globals : %v", err)
+	}
+	return nil
+}
@@ -1,14 +1,16 @@
 package filterjs
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/sirupsen/logrus"
-	"io/ioutil"
 	"net/http"
 	"strings"
 
+	"github.com/labbsr0x/go-horse/dockerapi"
 	"github.com/labbsr0x/go-horse/filters/model"
+	"github.com/labbsr0x/go-horse/util"
 
 	"github.com/kataras/iris/core/errors"
 
@@ -17,23 +19,67 @@ import (
 	"github.com/robertkrimen/otto"
 )
 
-var client = &http.Client{}
+// JS engines of the filters
+const (
+	// EngineOtto ES5 engine, the default one
+	EngineOtto = "otto"
+	// EngineGoja ES2015+ engine
+	EngineGoja = "goja"
+)
 
 // FilterJS JS proxy filter
 type FilterJS struct {
 	model.FilterConfig
+	// settingsJSON the filter settings encoded once, parsed as ctx.config on each execution
+	settingsJSON string
+	// pool VMs with the filter function compiled and evaluated once
+	pool    *vmPool
+	options Options
 }
 
-// NewFilterJS JS filter factory
-func NewFilterJS(innerType model.FilterConfig) FilterJS {
+// NewFilterJS JS filter factory. The filter function is compiled once, and run in a pool of VMs within the sandbox limits of the options
+func NewFilterJS(innerType model.FilterConfig, options Options) (FilterJS, error) {
 	filterJs := FilterJS{}
 	filterJs.FilterConfig = innerType
-	return filterJs
+	filterJs.options = options
+	if filterJs.Engine == "" {
+		filterJs.Engine = options.Engine
+	}
+	if filterJs.Engine == "" {
+		filterJs.Engine = EngineOtto
+	}
+	var newVM func() (vm, error)
+	var err error
+	switch filterJs.Engine {
+	case EngineOtto:
+		if newVM, err = newOttoFactory(filterJs.FilterConfig, options); err != nil {
+			return filterJs, fmt.Errorf("error compiling the filter function, ES2015+ syntax needs the %s engine : %v", EngineGoja, err)
+		}
+	case EngineGoja:
+		if newVM, err = newGojaFactory(filterJs.FilterConfig, options); err != nil {
+			return filterJs, fmt.Errorf("error compiling the filter function : %v", err)
+		}
+	default:
+		return filterJs, fmt.Errorf("unknown JS engine %q, expected %s or %s", filterJs.Engine, EngineOtto, EngineGoja)
+	}
+	filterJs.pool = newVMPool(innerType.Name, newVM, options.PoolSize)
+	filterJs.settingsJSON = "{}"
+	if innerType.Settings != nil {
+		if encoded, err := json.Marshal(innerType.Settings); err == nil {
+			filterJs.settingsJSON = string(encoded)
+		} else {
+			logrus.WithFields(logrus.Fields{
+				"plugin_name": innerType.Name,
+				"error":       err.Error(),
+			}).Errorf("Error encoding the filter settings - js filter")
+		}
+	}
+	return filterJs, nil
 }
 
 // MatchURL js
 func (filterJs FilterJS) MatchURL(ctx iris.Context) bool {
-	return filterJs.Regex.MatchString(ctx.RequestPath(false))
+	return filterJs.Regex == nil || filterJs.Regex.MatchString(ctx.RequestPath(false))
 }
 
 // Config js
@@ -41,9 +87,66 @@ func (filterJs FilterJS) Config() model.FilterConfig {
 	return filterJs.FilterConfig
 }
 
-// Exec run the filter
+// Exec run the filter, interrupting it if it goes over its CPU budget
 func (filterJs FilterJS) Exec(ctx iris.Context, body string) (model.FilterReturn, error) {
-	js := otto.New()
+	return filterJs.ExecCancelable(ctx, body, nil)
+}
+
+// ExecCancelable run the filter, interrupting it if it goes over its CPU budget or when cancel is closed. Its calls to
+// the daemon and its HTTP calls are canceled with it
+func (filterJs FilterJS) ExecCancelable(ctx iris.Context, body string, cancel <-chan struct{}) (result model.FilterReturn, err error) {
+	instance, err := filterJs.pool.acquire(cancel)
+	if err == errCanceled {
+		return model.FilterReturn{Next: false}, err
+	}
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"plugin_name": filterJs.Name,
+			"error":       err.Error(),
+		}).Errorf("Error creating the filter VM - js filter exec")
+		return model.FilterReturn{Next: false}, err
+	}
+
+	// the budget and the cancellation interrupt the VM and cancel the native calls in progress
+	execCtx, stopCtx := context.WithCancel(context.Background())
+	watch := watchInterrupts(filterJs.budget(), cancel, func(sentinel interface{}) {
+		stopCtx()
+		instance.interrupt(sentinel)
+	})
+	stop := func() {
+		watch.stop()
+		stopCtx()
+		instance.clearInterrupt()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			stop()
+			filterJs.pool.discard()
+			panic(r)
+		}
+	}()
+
+	result, err = instance.exec(filterJs, ctx, body, &execution{logger: filterJs.logger(ctx), context: execCtx, interrupts: watch})
+	stop()
+	if err == errInterrupted || err == errCanceled {
+		// the interrupted VM may be left in an inconsistent state, it is not reused
+		filterJs.pool.discard()
+	}
+	if err == errInterrupted {
+		return model.FilterReturn{Next: false}, &model.LimitError{
+			Filter: filterJs.Name,
+			Limit:  "CPU budget",
+			Detail: fmt.Sprintf("interrupted after %v", filterJs.budget()),
+		}
+	}
+	if err != errCanceled {
+		filterJs.pool.release(instance)
+	}
+	return result, err
+}
+
+// execOtto builds the ctx and plugins objects in the otto VM and runs the filter function
+func (filterJs FilterJS) execOtto(ctx iris.Context, js *otto.Otto, function otto.Value, body string, execution *execution) (model.FilterReturn, error) {
 
 	emptyBody, _ := js.Object("({})")
 	bodyParsed, _ := otto.ToValue(emptyBody)
@@ -57,7 +160,9 @@ func (filterJs FilterJS) Exec(ctx iris.Context, body string) (model.FilterReturn
 		contentType = ctx.ResponseWriter().Header().Get("Content-Type")
 		headers = ctx.ResponseWriter().Header()
 	}
-	if contentType == "application/json" {
+	info := newBodyInfo(contentType, body)
+	rawBody := info.rawBody(body)
+	if info.JSON {
 		if body == "" {
 			body = "{}"
 		}
@@ -77,35 +182,70 @@ func (filterJs FilterJS) Exec(ctx iris.Context, body string) (model.FilterReturn
 		}).Errorf("Error creating operation object - js filter exec")
 	}
 
-	urlParamsJsObj, _ := js.Object("({})")
-	urlParamsJsObj.Set("add", func(call otto.FunctionCall) otto.Value { return addURLParamsFromJSContext(ctx, call) })
-	urlParamsJsObj.Set("set", func(call otto.FunctionCall) otto.Value { return setURLParamsFromJSContext(ctx, call) })
-	urlParamsJsObj.Set("get", func(call otto.FunctionCall) otto.Value { return getURLParamsFromJSContext(ctx, call) })
-	urlParamsJsObj.Set("del", func(call otto.FunctionCall) otto.Value { return delURLParamsFromJSContext(ctx, call) })
-	urlParamsJsObj.Set("list", func(call otto.FunctionCall) otto.Value { return listURLParamsFromJSContext(ctx, call) })
-
-	valuesJsObj, _ := js.Object("({})")
-	valuesJsObj.Set("get", func(call otto.FunctionCall) otto.Value { return requestScopeGetToJSContext(ctx, call) })
-	valuesJsObj.Set("set", func(call otto.FunctionCall) otto.Value { return requestScopeSetToJSContext(ctx, call) })
-	valuesJsObj.Set("list", func(call otto.FunctionCall) otto.Value { return requestScopeListToJSContext(ctx, call) })
+	if filterJs.options.CaptureConsole {
+		consoleJsObj, _ := js.Object("({})")
+		for name, function := range consoleFunctions(execution.logger, true) {
+			consoleJsObj.Set(name, ottoFunction(function))
+		}
+		js.Set("console", consoleJsObj)
+	}
 
 	ctxJsObj, _ := js.Object("({})")
+	for object, functions := range filterJs.nativeFunctions(ctx, execution) {
+		jsObj, _ := js.Object("({})")
+		for name, function := range functions {
+			jsObj.Set(name, ottoFunction(function))
+		}
+		ctxJsObj.Set(object, jsObj)
+	}
 	ctxJsObj.Set("url", ctx.Request().URL.Path)
 	ctxJsObj.Set("body", bodyParsed.Object())
+	ctxJsObj.Set("rawBody", rawBody)
+	if bodyInfoJsObj, err := js.Call("JSON.parse", nil, info.json()); err == nil {
+		js.Call("Object.freeze", nil, bodyInfoJsObj)
+		ctxJsObj.Set("bodyInfo", bodyInfoJsObj)
+	}
+	if form := info.form(rawBody); form != nil {
+		ctxJsObj.Set("form", ottoValue(js, form))
+	}
 	ctxJsObj.Set("operation", operation)
 	ctxJsObj.Set("method", strings.ToUpper(ctx.Method()))
 	ctxJsObj.Set("headers", headers)
-	ctxJsObj.Set("request", httpRequestTOJSContext)
-	ctxJsObj.Set("values", valuesJsObj)
-	ctxJsObj.Set("urlParams", urlParamsJsObj)
-	ctxJsObj.Set("responseStatusCode", ctx.Values().GetString("responseStatusCode"))
+	ctxJsObj.Set("request", ottoFunction(execution.native(filterJs.options.HTTP.legacyRequest(execution.context))))
+	ctxJsObj.Set("responseStatusCode", ctx.Values().GetString(util.ResponseStatusCodeKey))
+
+	dockerOperation := dockerapi.FromContext(ctx)
+	pathParams := make(map[string]string)
+	for key, value := range dockerOperation.Params {
+		pathParams[key] = value
+	}
+	ctxJsObj.Set("operationId", dockerOperation.ID)
+	ctxJsObj.Set("apiVersion", dockerOperation.Version)
+	ctxJsObj.Set("pathParams", pathParams)
 
-	js.Set("ctx", ctxJsObj)
+	if config, err := js.Call("JSON.parse", nil, filterJs.settingsJSON); err == nil {
+		ctxJsObj.Set("config", config)
+	} else {
+		logrus.WithFields(logrus.Fields{
+			"plugin_name": filterJs.Name,
+			"error":       err.Error(),
+		}).Errorf("Error parsing the filter settings to JS object - js filter exec")
+	}
 
 	pluginsJsObj, _ := js.Object("({})")
 
 	for _, jsPlugin := range plugins.JSPluginList {
-		err := pluginsJsObj.Set(jsPlugin.Name(), func(call otto.FunctionCall) otto.Value { return jsPlugin.Set(ctx, call) })
+		jsPlugin := jsPlugin
+		var err error
+		if native, ok := jsPlugin.(plugins.JSNativeInjection); ok {
+			err = pluginsJsObj.Set(jsPlugin.Name(), ottoFunction(execution.native(nativePlugin(ctx, native))))
+		} else {
+			err = pluginsJsObj.Set(jsPlugin.Name(), func(call otto.FunctionCall) otto.Value {
+				execution.interrupts.pause()
+				defer execution.interrupts.resume()
+				return jsPlugin.Set(ctx, call)
+			})
+		}
 		if err != nil {
 			logrus.WithFields(logrus.Fields{
 				"plugin_name": jsPlugin.Name(),
@@ -113,17 +253,17 @@ func (filterJs FilterJS) Exec(ctx iris.Context, body string) (model.FilterReturn
 		}
 	}
 
-	js.Set("plugins", pluginsJsObj)
-
-	returnValue, err := js.Run("(" + filterJs.Function + ")(ctx, plugins)")
+	returnValue, err := function.Call(otto.UndefinedValue(), ctxJsObj, pluginsJsObj)
 
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"plugin_name": filterJs.Name,
-		}).Errorf("plugin_name: %v | Error executing filter - js filter exec")
-		return model.FilterReturn{Next: false, Body: "{\"message\" : \"Error from docker daemon proxy go-horse : \"" + err.Error() + "}"}, err
+		scriptErr := filterJs.scriptError(err)
+		logScriptError(scriptErr)
+		return model.FilterReturn{Next: false, Body: errorBody(scriptErr.Error())}, scriptErr
 	}
 
+	if !returnValue.IsObject() {
+		return errorReturnFilter(errors.New("the filter function must return an object"))
+	}
 	result := returnValue.Object()
 
 	jsFunctionReturn := model.FilterReturn{}
@@ -138,15 +278,20 @@ func (filterJs FilterJS) Exec(ctx iris.Context, body string) (model.FilterReturn
 		return errorReturnFilter(err)
 	}
 
+	returned := returnedBody{}
 	if value, err := result.Get("body"); err == nil {
-		if value, err := js.Call("JSON.stringify", nil, value); err == nil {
-			jsFunctionReturn.Body = value.String()
+		if encoded, err := js.Call("JSON.stringify", nil, value); err == nil {
+			returned.encoded = encoded.String()
+			returned.text, returned.isText = value.String(), value.IsString()
 		} else {
 			return errorReturnFilter(err)
 		}
 	} else {
 		return errorReturnFilter(err)
 	}
+	if value, err := result.Get("rawBody"); err == nil && value.IsDefined() {
+		returned.raw, returned.hasRaw = value.String(), true
+	}
 
 	if value, err := result.Get("operation"); err == nil {
 		if value, err := value.ToInteger(); err == nil {
@@ -158,6 +303,13 @@ func (filterJs FilterJS) Exec(ctx iris.Context, body string) (model.FilterReturn
 		return errorReturnFilter(err)
 	}
 
+	if jsFunctionReturn.Body, jsFunctionReturn.Operation, err = info.replacement(filterJs.Name, jsFunctionReturn.Operation, returned); err != nil {
+		return errorReturnFilter(err)
+	}
+	if err := filterJs.checkResultSize("body", jsFunctionReturn.Body); err != nil {
+		return model.FilterReturn{Next: false}, err
+	}
+
 	if value, err := result.Get("status"); err == nil {
 		if value, err := value.ToInteger(); err == nil {
 			jsFunctionReturn.Status = int(value)
@@ -179,133 +331,158 @@ func (filterJs FilterJS) Exec(ctx iris.Context, body string) (model.FilterReturn
 	} else {
 		return errorReturnFilter(err)
 	}
+
+	if value, err := result.Get("headers"); err == nil {
+		if value.IsDefined() {
+			if headers, err := readHeaderOperations(value); err == nil {
+				jsFunctionReturn.Headers = headers
+			} else {
+				return errorReturnFilter(err)
+			}
+		}
+	} else {
+		return errorReturnFilter(err)
+	}
+
+	if value, err := result.Get("response"); err == nil {
+		if value.IsDefined() && !value.IsNull() {
+			if response, err := readSyntheticResponse(js, value); err == nil {
+				if err := filterJs.checkResultSize("response body", response.Body); err != nil {
+					return model.FilterReturn{Next: false}, err
+				}
+				jsFunctionReturn.Response = response
+			} else {
+				return errorReturnFilter(err)
+			}
+		}
+	} else {
+		return errorReturnFilter(err)
+	}
 	// weird
 	return jsFunctionReturn, jsFunctionReturn.Err
 }
 
-func errorReturnFilter(err error) (model.FilterReturn, error) {
-	logrus.WithFields(logrus.Fields{
-		"error": err.Error(),
-	}).Errorf("Error parsing filter return value - js filter exec")
-	return model.FilterReturn{Body: "{\"message\" : \"Proxy error : \"" + err.Error() + "}"}, err
-}
-
-func httpRequestTOJSContext(call otto.FunctionCall) otto.Value {
-
-	method, err := call.Argument(0).ToString()
-	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"error": err.Error(),
-		}).Errorf("Error parsing httpRequestTOJSContext method - js filter exec")
+// readSyntheticResponse reads the {status, headers, contentType, body} response property of the filter return.
+// A body other than a string is serialized as JSON
+func readSyntheticResponse(js *otto.Otto, value otto.Value) (*model.SyntheticResponse, error) {
+	if !value.IsObject() {
+		return nil, fmt.Errorf("expected response to be an object like {status, headers, contentType, body}, got %v", value)
 	}
+	object := value.Object()
+	response := &model.SyntheticResponse{}
 
-	url, err := call.Argument(1).ToString()
-	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"error": err.Error(),
-		}).Errorf("Error parsing httpRequestTOJSContext url - js filter exec")
+	if status, err := object.Get("status"); err != nil {
+		return nil, err
+	} else if status.IsDefined() {
+		code, err := status.ToInteger()
+		if err != nil {
+			return nil, err
+		}
+		response.Status = int(code)
+	}
+	if err := response.CheckStatus(); err != nil {
+		return nil, err
 	}
 
-	body, err := call.Argument(2).ToString()
-	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"error": err.Error(),
-		}).Errorf("Error parsing httpRequestTOJSContext body - js filter exec")
+	if headers, err := object.Get("headers"); err != nil {
+		return nil, err
+	} else if headers.IsDefined() {
+		if response.Headers, err = readStringMap(headers); err != nil {
+			return nil, err
+		}
 	}
 
-	var req *http.Request
+	if contentType, err := object.Get("contentType"); err != nil {
+		return nil, err
+	} else if contentType.IsDefined() {
+		response.ContentType = contentType.String()
+	}
 
-	if method == "GET" {
-		req, err = http.NewRequest(method, url, nil)
-		if err != nil {
-			logrus.WithFields(logrus.Fields{
-				"error": err.Error(),
-			}).Errorf("Error parsing httpRequestTOJSContext GET header - js filter exec")
-		}
-	} else {
-		req, err = http.NewRequest(method, url, strings.NewReader(body))
+	if body, err := object.Get("body"); err != nil {
+		return nil, err
+	} else if body.IsString() {
+		response.Body = body.String()
+	} else if body.IsDefined() {
+		serialized, err := js.Call("JSON.stringify", nil, body)
 		if err != nil {
-			logrus.WithFields(logrus.Fields{
-				"error": err.Error(),
-			}).Errorf("Error parsing httpRequestTOJSContext OTHER THAN GET header - js filter exec")
+			return nil, err
 		}
+		response.Body = serialized.String()
 	}
+	return response, nil
+}
 
-	headers := call.Argument(3).Object()
-	if headers != nil {
-		for _, key := range headers.Keys() {
-			header, err := headers.Get(key)
-			if err != nil {
-				logrus.WithFields(logrus.Fields{
-					"error": err.Error(),
-				}).Errorf("Error parsing httpRequestTOJSContext GET header - js filter exec")
-			}
-			headerValue, err := header.ToString()
-			if err != nil {
-				logrus.WithFields(logrus.Fields{
-					"error": err.Error(),
-				}).Errorf("Error parsing httpRequestTOJSContext GET header - js filter exec")
-			}
-			req.Header.Add(key, headerValue)
+// readHeaderOperations reads the {set: {name: value}, remove: [name]} headers property of the filter return
+func readHeaderOperations(value otto.Value) (model.HeaderOperations, error) {
+	headers := model.HeaderOperations{}
+	if !value.IsObject() {
+		return headers, fmt.Errorf("expected headers to be an object like {set: {}, remove: []}, got %v", value)
+	}
+	if set, err := value.Object().Get("set"); err != nil {
+		return headers, err
+	} else if set.IsDefined() {
+		if headers.Set, err = readStringMap(set); err != nil {
+			return headers, err
 		}
 	}
+	if remove, err := value.Object().Get("remove"); err != nil {
+		return headers, err
+	} else if remove.IsDefined() {
+		if headers.Remove, err = readStringList(remove); err != nil {
+			return headers, err
+		}
+	}
+	return headers, nil
+}
 
+func errorReturnFilter(err error) (model.FilterReturn, error) {
 	logrus.WithFields(logrus.Fields{
-		"method": method,
-		"url": url,
-		"body": body,
-		"headers": fmt.Sprintf("%#v", headers),
-	}).Infof("Request parameters")
+		"error": err.Error(),
+	}).Errorf("Error parsing filter return value - js filter exec")
+	return model.FilterReturn{Body: errorBody("Proxy error : " + err.Error())}, err
+}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"error": err.Error(),
-		}).Errorf("Error executing the request - httpRequestTOJSContext")
-		response, _ := call.Otto.Object("({})")
-		buf, marshalError := json.Marshal(err)
-		if marshalError == nil {
-			response.Set("body", fmt.Sprintf("%v", string(buf)))
-		} else {
-			response.Set("body", fmt.Sprintf("%#v", err))
-		}
-		response.Set("status", 0)
-		value, _ := otto.ToValue(response)
-		return value
+// readStringList reads a JS array of strings, a single string is accepted as a one element list
+func readStringList(value otto.Value) ([]string, error) {
+	if value.IsString() {
+		return []string{value.String()}, nil
 	}
-	defer resp.Body.Close()
-	if req.Body != nil {
-		defer req.Body.Close()
+	if !value.IsObject() {
+		return nil, fmt.Errorf("expected an array of strings, got %v", value)
 	}
-
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"error": err.Error(),
-		}).Errorf("Error parsing request body - httpRequestTOJSContext ")
+	var list []string
+	array := value.Object()
+	for _, key := range array.Keys() {
+		item, err := array.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		str, err := item.ToString()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, str)
 	}
+	return list, nil
+}
 
-	response, _ := call.Otto.Object("({})")
-
-	bodyObjectJs, err := call.Otto.ToValue(string(bodyBytes))
-	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"error": err.Error(),
-		}).Errorf("Error parsing response body to JS object - httpRequestTOJSContext")
+// readStringMap reads a JS object whose values are strings
+func readStringMap(value otto.Value) (map[string]string, error) {
+	if !value.IsObject() {
+		return nil, fmt.Errorf("expected an object, got %v", value)
 	}
-
-	headersObjectJs, err := call.Otto.ToValue(resp.Header)
-	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"error": err.Error(),
-		}).Errorf("Error parsing response headers to JS object - httpRequestTOJSContext")
+	values := make(map[string]string)
+	object := value.Object()
+	for _, key := range object.Keys() {
+		item, err := object.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		str, err := item.ToString()
+		if err != nil {
+			return nil, err
+		}
+		values[key] = str
 	}
-
-	response.Set("body", bodyObjectJs)
-	response.Set("status", resp.StatusCode)
-	response.Set("headers", headersObjectJs)
-
-	value, _ := otto.ToValue(response)
-
-	return value
+	return values, nil
 }
@@ -0,0 +1,357 @@
+package filterjs
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/context"
+	"github.com/labbsr0x/go-horse/filters/model"
+)
+
+var engines = []string{EngineOtto, EngineGoja}
+
+var app = iris.New()
+
+// writeFilters writes the files of a JS filters directory, like acl.js or lib/utils.js
+func writeFilters(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "filterjs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// loadFilter loads the only filter of the directory and creates it on the engine
+func loadFilter(t *testing.T, dir, engine string, options Options) FilterJS {
+	library := LoadLibrary(dir)
+	configs, loadErrors := Load(dir, library)
+	if len(loadErrors) > 0 || len(configs) != 1 {
+		t.Fatalf("expected one filter, got %v and errors %v", configs, loadErrors)
+	}
+	options.Engine = engine
+	options.Library = library
+	filter, err := NewFilterJS(configs[0], options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filter
+}
+
+// requestFilter a request filter file with the function
+func requestFilter(function string) string {
+	return `{"name": "acl", "invoke": "request", "function": ` + function + `}`
+}
+
+func newContext(contentType, body string) iris.Context {
+	req := httptest.NewRequest(http.MethodPost, "/v1.39/containers/create", strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	ctx := context.NewContext(app)
+	ctx.BeginRequest(httptest.NewRecorder(), req)
+	return ctx
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func TestEngines(t *testing.T) {
+	tests := []struct {
+		name        string
+		function    string
+		contentType string
+		body        string
+		expect      model.FilterReturn
+		err         string
+	}{
+		{
+			name:        "json body",
+			function:    `function(ctx) { ctx.body.Labels = {team: "ops"}; return {next: true, body: ctx.body, operation: ctx.operation.WRITE}; }`,
+			contentType: "application/json",
+			body:        `{"Image":"nginx"}`,
+			expect:      model.FilterReturn{Next: true, Body: `{"Image":"nginx","Labels":{"team":"ops"}}`, Operation: model.Write},
+		},
+		{
+			name:        "denial",
+			function:    `function(ctx) { return {next: false, status: 403, body: ctx.body, error: ctx.method + " denied"}; }`,
+			contentType: "application/json",
+			body:        `{}`,
+			expect:      model.FilterReturn{Next: false, Status: 403, Body: `{}`},
+			err:         "POST denied",
+		},
+		{
+			name:        "form body",
+			function:    `function(ctx) { return {next: ctx.bodyInfo.form, body: ctx.form.team[0] + ":" + ctx.form.image.length, operation: ctx.operation.WRITE}; }`,
+			contentType: "application/x-www-form-urlencoded",
+			body:        "team=ops&image=nginx&image=redis",
+			expect:      model.FilterReturn{Next: true, Body: "ops:2", Operation: model.Write},
+		},
+		{
+			name:        "text raw body",
+			function:    `function(ctx) { return {next: ctx.bodyInfo.encoding === "text", rawBody: ctx.rawBody.toUpperCase(), operation: ctx.operation.WRITE}; }`,
+			contentType: "text/plain",
+			body:        "hello",
+			expect:      model.FilterReturn{Next: true, Body: "HELLO", Operation: model.Write},
+		},
+		{
+			name:        "binary raw body",
+			function:    `function(ctx) { return {next: ctx.bodyInfo.binary && ctx.rawBody === "AAE=", rawBody: "AAI=", operation: ctx.operation.WRITE}; }`,
+			contentType: "application/octet-stream",
+			body:        "\x00\x01",
+			expect:      model.FilterReturn{Next: true, Body: "\x00\x02", Operation: model.Write},
+		},
+		{
+			name:        "binary body kept without raw body",
+			function:    `function(ctx) { return {next: true, body: {}, operation: ctx.operation.WRITE}; }`,
+			contentType: "application/x-tar",
+			body:        "\x00\x01",
+			expect:      model.FilterReturn{Next: true, Body: "{}", Operation: model.Read},
+		},
+		{
+			name:     "undefined return",
+			function: `function(ctx) { ctx.values.set("called", true); }`,
+			expect:   model.FilterReturn{Body: errorBody("Proxy error : the filter function must return an object")},
+			err:      "the filter function must return an object",
+		},
+		{
+			name:     "null return",
+			function: `function(ctx) { return null; }`,
+			expect:   model.FilterReturn{Body: errorBody("Proxy error : the filter function must return an object")},
+			err:      "the filter function must return an object",
+		},
+		{
+			name:     "primitive return",
+			function: `function(ctx) { return true; }`,
+			expect:   model.FilterReturn{Body: errorBody("Proxy error : the filter function must return an object")},
+			err:      "the filter function must return an object",
+		},
+	}
+	for _, engine := range engines {
+		for _, test := range tests {
+			t.Run(engine+"/"+test.name, func(t *testing.T) {
+				dir := writeFilters(t, map[string]string{"acl.js": requestFilter(test.function)})
+				defer os.RemoveAll(dir)
+				filter := loadFilter(t, dir, engine, Options{})
+
+				result, err := filter.Exec(newContext(test.contentType, test.body), test.body)
+				if errorString(err) != test.err {
+					t.Fatalf("expected the error %q, got %v", test.err, err)
+				}
+				if result.Next != test.expect.Next || result.Body != test.expect.Body || result.Status != test.expect.Status || result.Operation != test.expect.Operation {
+					t.Fatalf("expected %+v, got %+v", test.expect, result)
+				}
+			})
+		}
+	}
+}
+
+func TestPoolResetsAndReplacesInterruptedVMs(t *testing.T) {
+	// the module cache lives as long as the VM, the leaked global is deleted after each execution
+	files := map[string]string{
+		"lib/counter.js": `var count = 0; exports.next = function() { return ++count; };`,
+		"acl.js": requestFilter(`function(ctx) {
+			var status = (typeof leaked === "undefined" ? 200 : 400) + require("counter").next();
+			leaked = true;
+			while (ctx.body.loop) {}
+			return {next: true, status: status};
+		}`),
+	}
+	dir := writeFilters(t, files)
+	defer os.RemoveAll(dir)
+	for _, engine := range engines {
+		t.Run(engine, func(t *testing.T) {
+			filter := loadFilter(t, dir, engine, Options{PoolSize: 1, CPUBudget: 100 * time.Millisecond})
+			steps := []struct {
+				body   string
+				status int
+				limit  string
+			}{
+				{body: `{}`, status: 201},
+				{body: `{}`, status: 202},
+				{body: `{"loop": true}`, limit: "CPU budget"},
+				{body: `{}`, status: 201},
+				{body: `{}`, status: 202},
+			}
+			for i, step := range steps {
+				result, err := filter.Exec(newContext("application/json", step.body), step.body)
+				if step.limit != "" {
+					if limitErr, ok := err.(*model.LimitError); !ok || limitErr.Limit != step.limit {
+						t.Fatalf("step %d : expected the %s limit error, got %v", i, step.limit, err)
+					}
+					continue
+				}
+				if err != nil || result.Status != step.status {
+					t.Fatalf("step %d : expected the status %d, got %d and %v", i, step.status, result.Status, err)
+				}
+			}
+		})
+	}
+}
+
+func TestLimits(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer slow.Close()
+
+	tests := []struct {
+		name     string
+		function string
+		// properties of the filter definition
+		properties string
+		options    Options
+		status     int
+		limit      string
+	}{
+		{
+			name:     "budget",
+			function: `function(ctx) { while (true) {} }`,
+			options:  Options{CPUBudget: 100 * time.Millisecond},
+			limit:    "CPU budget",
+		},
+		{
+			name:       "filter budget",
+			function:   `function(ctx) { while (true) {} }`,
+			properties: `"cpuBudget": 100, `,
+			options:    Options{CPUBudget: time.Hour},
+			limit:      "CPU budget",
+		},
+		{
+			name:     "native calls out of the budget",
+			function: `function(ctx) { var status = 0; for (var i = 0; i < 2; i++) { status = ctx.http.get("` + slow.URL + `").status; } return {next: true, status: status}; }`,
+			options:  Options{CPUBudget: 100 * time.Millisecond},
+			status:   http.StatusNoContent,
+		},
+		{
+			name:     "body size",
+			function: `function(ctx) { return {next: true, body: new Array(33).join("x"), operation: ctx.operation.WRITE}; }`,
+			options:  Options{MaxResultSize: 16},
+			limit:    "result size",
+		},
+		{
+			name:     "response body size",
+			function: `function(ctx) { return {next: false, response: {status: 200, body: new Array(33).join("x")}}; }`,
+			options:  Options{MaxResultSize: 16},
+			limit:    "result size",
+		},
+		{
+			name:     "body under the size",
+			function: `function(ctx) { return {next: true, status: 200, body: new Array(17).join("x"), operation: ctx.operation.WRITE}; }`,
+			options:  Options{MaxResultSize: 16},
+			status:   http.StatusOK,
+		},
+	}
+	for _, engine := range engines {
+		for _, test := range tests {
+			t.Run(engine+"/"+test.name, func(t *testing.T) {
+				source := `{"name": "acl", "invoke": "request", ` + test.properties + `"function": ` + test.function + `}`
+				dir := writeFilters(t, map[string]string{"acl.js": source})
+				defer os.RemoveAll(dir)
+				filter := loadFilter(t, dir, engine, test.options)
+
+				result, err := filter.Exec(newContext("text/plain", ""), "")
+				if test.limit != "" {
+					if limitErr, ok := err.(*model.LimitError); !ok || limitErr.Limit != test.limit || result.Next {
+						t.Fatalf("expected the %s limit error, got %v", test.limit, err)
+					}
+					return
+				}
+				if err != nil || result.Status != test.status {
+					t.Fatalf("expected the status %d, got %d and %v", test.status, result.Status, err)
+				}
+			})
+		}
+	}
+}
+
+func TestDeniedGlobals(t *testing.T) {
+	tests := []struct {
+		name     string
+		function string
+		err      string
+	}{
+		{
+			name:     "denied",
+			function: `function(ctx) { try { eval("1"); } catch (e) { return {next: false, error: e.name + ": " + e.message}; } return {next: true}; }`,
+			err:      "DeniedGlobalError: eval is denied in go-horse filters (filter acl)",
+		},
+		{
+			name:     "uncaught",
+			function: `function(ctx) { return {next: eval("true")}; }`,
+			err:      "filter acl : DeniedGlobalError: eval is denied in go-horse filters (filter acl)",
+		},
+		{
+			name:     "protected",
+			function: `function(ctx) { return {next: JSON.parse(JSON.stringify({ok: true})).ok}; }`,
+		},
+	}
+	for _, engine := range engines {
+		for _, test := range tests {
+			t.Run(engine+"/"+test.name, func(t *testing.T) {
+				dir := writeFilters(t, map[string]string{"acl.js": requestFilter(test.function)})
+				defer os.RemoveAll(dir)
+				filter := loadFilter(t, dir, engine, Options{DeniedGlobals: []string{"eval", "JSON"}})
+
+				result, err := filter.Exec(newContext("", ""), "")
+				if !strings.HasPrefix(errorString(err), test.err) || (test.err == "") != (err == nil) {
+					t.Fatalf("expected the error %q, got %v", test.err, err)
+				}
+				if result.Next != (test.err == "") {
+					t.Fatalf("expected next %v, got %+v", test.err == "", result)
+				}
+			})
+		}
+	}
+}
+
+func TestScriptErrorLocation(t *testing.T) {
+	source := `{"name": "acl", "invoke": "request",
+	"function": function(ctx) {
+		var image = ctx.body.Image;
+		throw new TypeError(image + " is not allowed");
+	}
+}`
+	dir := writeFilters(t, map[string]string{"acl.js": source})
+	defer os.RemoveAll(dir)
+	for _, engine := range engines {
+		t.Run(engine, func(t *testing.T) {
+			filter := loadFilter(t, dir, engine, Options{})
+
+			result, err := filter.Exec(newContext("application/json", `{"Image":"redis"}`), `{"Image":"redis"}`)
+			scriptErr, ok := err.(*model.ScriptError)
+			if !ok {
+				t.Fatalf("expected a script error, got %v", err)
+			}
+			if scriptErr.File != filepath.Join(dir, "acl.js") || scriptErr.Line != 4 || scriptErr.Column < 3 {
+				t.Fatalf("expected the error at acl.js:4, got %s:%d:%d", scriptErr.File, scriptErr.Line, scriptErr.Column)
+			}
+			if scriptErr.Name != "TypeError" || scriptErr.Message != "redis is not allowed" || len(scriptErr.Stack) == 0 {
+				t.Fatalf("expected the thrown TypeError, got %+v", scriptErr)
+			}
+			if result.Next || result.Body != errorBody(scriptErr.Error()) {
+				t.Fatalf("expected the error body, got %+v", result)
+			}
+		})
+	}
+}
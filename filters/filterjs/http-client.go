@@ -0,0 +1,370 @@
+package filterjs
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labbsr0x/go-horse/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// HTTPOptions settings of the HTTP client of the JS filters
+type HTTPOptions struct {
+	// Timeout default timeout of a call, retries included. Calls can set their own
+	Timeout time.Duration
+	// AllowedHosts destination hosts the filters can call, like registry.example.com, *.example.com or
+	// localhost:5000. Any host if empty
+	AllowedHosts []string
+	// CertFile and KeyFile client certificate sent to the TLS servers asking for one
+	CertFile string
+	KeyFile  string
+	// CAFile certificates of the authorities trusted besides the system ones
+	CAFile string
+	// Retries how many times an idempotent call is retried after a network error or a 502, 503 or 504 status
+	Retries int
+}
+
+// HTTPClient the client behind ctx.http and ctx.request, shared by the JS filters
+type HTTPClient struct {
+	client  *http.Client
+	options HTTPOptions
+}
+
+// defaultHTTPClient used by the filters created without a client
+var defaultHTTPClient, _ = NewHTTPClient(HTTPOptions{Timeout: 10 * time.Second})
+
+// retryBackoff wait before the first retry, doubled on each one
+const retryBackoff = 100 * time.Millisecond
+
+// maxRedirects redirects a call follows before failing
+const maxRedirects = 10
+
+// NewHTTPClient HTTPClient factory. It fails when the TLS files can't be read
+func NewHTTPClient(options HTTPOptions) (*HTTPClient, error) {
+	tlsConfig := &tls.Config{}
+	if options.CertFile != "" || options.KeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading the JS filters HTTP client certificate : %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	if options.CAFile != "" {
+		pem, err := ioutil.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the JS filters HTTP client CA file : %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in the JS filters HTTP client CA file %s", options.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:     tlsConfig,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	httpClient := &HTTPClient{options: options}
+	httpClient.client = &http.Client{Transport: transport, CheckRedirect: httpClient.checkRedirect}
+	return httpClient, nil
+}
+
+// checkRedirect checks every redirect against the allowed hosts, up to maxRedirects
+func (c *HTTPClient) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	return c.allowed(req.URL)
+}
+
+// httpCall a call made by a filter
+type httpCall struct {
+	method  string
+	url     string
+	headers map[string]string
+	body    []byte
+	timeout time.Duration
+}
+
+// httpResult the response of a call, with the body read
+type httpResult struct {
+	status  int
+	headers http.Header
+	body    []byte
+}
+
+func (c *HTTPClient) orDefault() *HTTPClient {
+	if c == nil {
+		return defaultHTTPClient
+	}
+	return c
+}
+
+// allowed checks the destination against the allowed hosts. Entries with a port only match that port
+func (c *HTTPClient) allowed(destination *url.URL) error {
+	if destination.Scheme != "http" && destination.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme %q, only http and https calls are allowed", destination.Scheme)
+	}
+	if len(c.options.AllowedHosts) == 0 {
+		return nil
+	}
+	hostname := strings.ToLower(destination.Hostname())
+	host := strings.ToLower(destination.Host)
+	for _, allowed := range c.options.AllowedHosts {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		candidate := hostname
+		if strings.Contains(allowed, ":") {
+			candidate = host
+		}
+		if candidate == allowed || strings.HasPrefix(allowed, "*.") && strings.HasSuffix(candidate, allowed[1:]) {
+			return nil
+		}
+	}
+	return fmt.Errorf("host %s is not allowed for the JS filters HTTP calls", destination.Host)
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func retryable(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+// do runs the call within its timeout, retrying the idempotent ones. The call is canceled with parent
+func (c *HTTPClient) do(parent context.Context, call httpCall) (*httpResult, error) {
+	destination, err := url.Parse(call.url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url %q : %v", call.url, err)
+	}
+	if err := c.allowed(destination); err != nil {
+		return nil, err
+	}
+	timeout := call.timeout
+	if timeout <= 0 {
+		timeout = c.options.Timeout
+	}
+	callCtx := parent
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(callCtx, timeout)
+		defer cancel()
+	}
+	retries := 0
+	if idempotent(call.method) {
+		retries = c.options.Retries
+	}
+	for attempt := 0; ; attempt++ {
+		result, err := c.attempt(callCtx, destination, call)
+		if attempt >= retries || (err == nil && !retryable(result.status)) {
+			return result, err
+		}
+		logrus.WithFields(logrus.Fields{
+			"method":  call.method,
+			"host":    destination.Host,
+			"attempt": attempt + 1,
+		}).Debugf("Retrying the call - js filter http")
+		select {
+		case <-time.After(retryBackoff << uint(attempt)):
+		case <-callCtx.Done():
+			return result, err
+		}
+	}
+}
+
+func (c *HTTPClient) attempt(callCtx context.Context, destination *url.URL, call httpCall) (*httpResult, error) {
+	var body io.Reader
+	if call.body != nil {
+		body = bytes.NewReader(call.body)
+	}
+	req, err := http.NewRequest(call.method, destination.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range call.headers {
+		req.Header.Set(key, value)
+	}
+
+	metrics := prometheus.GetMetrics()
+	start := time.Now()
+	resp, err := c.client.Do(req.WithContext(callCtx))
+	metrics.JSHTTPLatency.WithLabelValues(destination.Host).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.JSHTTPCount.WithLabelValues(destination.Host, "error").Inc()
+		return nil, err
+	}
+	defer resp.Body.Close()
+	metrics.JSHTTPCount.WithLabelValues(destination.Host, strconv.Itoa(resp.StatusCode)).Inc()
+
+	logrus.WithFields(logrus.Fields{
+		"method": call.method,
+		"host":   destination.Host,
+		"path":   destination.Path,
+		"status": resp.StatusCode,
+	}).Debugf("Call done - js filter http")
+
+	responseBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the response body : %v", err)
+	}
+	return &httpResult{status: resp.StatusCode, headers: resp.Header, body: responseBody}, nil
+}
+
+// functions the functions of the ctx.http object, their calls are canceled with parent
+func (c *HTTPClient) functions(parent context.Context) map[string]nativeFunction {
+	c = c.orDefault()
+	withoutBody := func(method string) nativeFunction {
+		return func(call nativeCall) (interface{}, error) {
+			return c.jsCall(parent, method, call.Argument(0), nil, call.Object(1)), nil
+		}
+	}
+	withBody := func(method string) nativeFunction {
+		return func(call nativeCall) (interface{}, error) {
+			return c.jsCall(parent, method, call.Argument(0), call.Argument(1), call.Object(2)), nil
+		}
+	}
+	return map[string]nativeFunction{
+		"request": func(call nativeCall) (interface{}, error) {
+			options := call.Object(0)
+			method, _ := options["method"].(string)
+			if method == "" {
+				method = http.MethodGet
+			}
+			return c.jsCall(parent, method, options["url"], options["body"], options), nil
+		},
+		"get":     withoutBody(http.MethodGet),
+		"head":    withoutBody(http.MethodHead),
+		"delete":  withoutBody(http.MethodDelete),
+		"post":    withBody(http.MethodPost),
+		"put":     withBody(http.MethodPut),
+		"patch":   withBody(http.MethodPatch),
+		"options": withoutBody(http.MethodOptions),
+	}
+}
+
+// jsCall runs a ctx.http call and returns its response object : status, headers, body (decoded when it is JSON), text
+// and error. Failed calls have a 0 status and the error message, they don't throw
+func (c *HTTPClient) jsCall(parent context.Context, method string, urlValue, bodyValue interface{}, options map[string]interface{}) map[string]interface{} {
+	response := map[string]interface{}{"status": 0, "headers": map[string]interface{}{}, "body": nil, "text": "", "error": nil}
+	fail := func(err error) map[string]interface{} {
+		logrus.WithFields(logrus.Fields{
+			"method": method,
+			"error":  err.Error(),
+		}).Errorf("Error executing the call - js filter http")
+		response["error"] = err.Error()
+		return response
+	}
+
+	destination, ok := urlValue.(string)
+	if !ok {
+		return fail(errors.New("the url must be a string"))
+	}
+	request := httpCall{method: strings.ToUpper(method), url: destination, headers: map[string]string{}}
+	if headers, ok := options["headers"].(map[string]interface{}); ok {
+		for key, value := range headers {
+			request.headers[key] = fmt.Sprint(value)
+		}
+	}
+	if timeout, ok := toFloat(options["timeout"]); ok {
+		request.timeout = time.Duration(timeout * float64(time.Millisecond))
+	}
+	if text, ok := bodyValue.(string); ok {
+		request.body = []byte(text)
+	} else if bodyValue != nil {
+		var err error
+		if request.body, err = json.Marshal(bodyValue); err != nil {
+			return fail(fmt.Errorf("error encoding the body to JSON : %v", err))
+		}
+		if _, ok := headerValue(request.headers, "Content-Type"); !ok {
+			request.headers["Content-Type"] = "application/json"
+		}
+	}
+
+	result, err := c.do(parent, request)
+	if err != nil {
+		return fail(err)
+	}
+	response["status"] = result.status
+	response["headers"] = map[string][]string(result.headers)
+	response["text"] = string(result.body)
+	response["body"] = string(result.body)
+	if strings.Contains(result.headers.Get("Content-Type"), "json") && len(result.body) > 0 && json.Valid(result.body) {
+		response["body"] = json.RawMessage(result.body)
+	}
+	return response
+}
+
+func headerValue(headers map[string]string, name string) (string, bool) {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// legacyRequest ctx.request(method, url, body, headers), kept for the filters written before ctx.http. The response
+// body is the raw string
+func (c *HTTPClient) legacyRequest(parent context.Context) nativeFunction {
+	c = c.orDefault()
+	return func(call nativeCall) (interface{}, error) {
+		return c.legacyCall(parent, call)
+	}
+}
+
+func (c *HTTPClient) legacyCall(parent context.Context, call nativeCall) (interface{}, error) {
+	request := httpCall{
+		method:  strings.ToUpper(call.String(0)),
+		url:     call.String(1),
+		headers: map[string]string{},
+	}
+	if request.method != http.MethodGet && call.Argument(2) != nil {
+		request.body = []byte(call.String(2))
+	}
+	for key, value := range call.Object(3) {
+		request.headers[key] = fmt.Sprint(value)
+	}
+
+	result, err := c.do(parent, request)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"method": request.method,
+			"error":  err.Error(),
+		}).Errorf("Error executing the request - httpRequestTOJSContext")
+		buf, _ := json.Marshal(map[string]string{"message": err.Error()})
+		return map[string]interface{}{"body": string(buf), "status": 0}, nil
+	}
+	return map[string]interface{}{
+		"body":    string(result.body),
+		"status":  result.status,
+		"headers": map[string][]string(result.headers),
+	}, nil
+}
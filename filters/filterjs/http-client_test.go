@@ -0,0 +1,105 @@
+package filterjs
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestHTTPClient(t *testing.T) {
+	var mutex sync.Mutex
+	attempts := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		attempts[r.URL.Query().Get("id")]++
+		attempt := attempts[r.URL.Query().Get("id")]
+		mutex.Unlock()
+		switch r.URL.Path {
+		case "/redirect":
+			// the redirect goes to the same server through another host name
+			http.Redirect(w, r, r.URL.Query().Get("to"), http.StatusFound)
+		case "/flaky":
+			if attempt <= 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+	local := "http://localhost:" + strconv.Itoa(port)
+
+	tests := []struct {
+		name     string
+		options  HTTPOptions
+		method   string
+		url      string
+		status   int
+		err      string
+		attempts int
+	}{
+		{name: "any host", url: server.URL + "/ok", status: http.StatusOK, attempts: 1},
+		{name: "allowed host", options: HTTPOptions{AllowedHosts: []string{"127.0.0.1"}}, url: server.URL + "/ok", status: http.StatusOK, attempts: 1},
+		{name: "allowed host and port", options: HTTPOptions{AllowedHosts: []string{server.Listener.Addr().String()}}, url: server.URL + "/ok", status: http.StatusOK, attempts: 1},
+		{name: "other port", options: HTTPOptions{AllowedHosts: []string{"127.0.0.1:1"}}, url: server.URL + "/ok", err: "is not allowed"},
+		{name: "wildcard", options: HTTPOptions{AllowedHosts: []string{"*.example.com"}}, url: server.URL + "/ok", err: "is not allowed"},
+		{name: "scheme", url: "file:///etc/passwd", err: `unsupported scheme "file"`},
+		{
+			name:     "redirect to an allowed host",
+			options:  HTTPOptions{AllowedHosts: []string{"127.0.0.1", "localhost"}},
+			url:      server.URL + "/redirect?to=" + url.QueryEscape(local+"/ok"),
+			status:   http.StatusOK,
+			attempts: 1,
+		},
+		{
+			name:     "redirect to a host not allowed",
+			options:  HTTPOptions{AllowedHosts: []string{"127.0.0.1"}},
+			url:      server.URL + "/redirect?to=" + url.QueryEscape(local+"/ok"),
+			err:      "host localhost:" + strconv.Itoa(port) + " is not allowed",
+			attempts: 1,
+		},
+		{name: "retries", options: HTTPOptions{Retries: 2}, url: server.URL + "/flaky", status: http.StatusOK, attempts: 3},
+		{name: "retries exhausted", options: HTTPOptions{Retries: 1}, url: server.URL + "/flaky", status: http.StatusServiceUnavailable, attempts: 2},
+		{name: "no retry of a POST", options: HTTPOptions{Retries: 2}, method: http.MethodPost, url: server.URL + "/flaky", status: http.StatusServiceUnavailable, attempts: 1},
+	}
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, err := NewHTTPClient(test.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			method := test.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			id := strconv.Itoa(i)
+			destination := test.url + "?id=" + id
+			if strings.Contains(test.url, "?") {
+				destination = test.url + "&id=" + id
+			}
+
+			result, err := client.do(context.Background(), httpCall{method: method, url: destination})
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected the error %q, got %v", test.err, err)
+				}
+			} else if err != nil || result.status != test.status {
+				t.Fatalf("expected the status %d, got %+v and %v", test.status, result, err)
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			if attempts[id] != test.attempts {
+				t.Fatalf("expected %d attempts, got %d", test.attempts, attempts[id])
+			}
+		})
+	}
+}
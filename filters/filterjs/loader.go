@@ -1,18 +1,25 @@
 package filterjs
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/sirupsen/logrus"
 	"io/ioutil"
+	"path/filepath"
 	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/labbsr0x/go-horse/filters/model"
-	"github.com/robertkrimen/otto"
+	"github.com/labbsr0x/go-horse/filters/settings"
+	"github.com/dop251/goja"
 )
 
-// Load load the filter from files
-func Load(jsFiltersPath string) []model.FilterConfig {
-	return parseFilterObject(readFromFile(jsFiltersPath))
+// Load load the filter from files, along with the errors of the filters left out because of their settings.
+// The library modules can be required by the configure functions
+func Load(jsFiltersPath string, library *Library) ([]model.FilterConfig, []model.LoadError) {
+	return parseFilterObject(jsFiltersPath, readFromFile(jsFiltersPath), library)
 }
 
 func readFromFile(jsFiltersPath string) map[string]string {
@@ -26,6 +33,15 @@ func readFromFile(jsFiltersPath string) map[string]string {
 	}
 
 	for _, file := range files {
+		if file.IsDir() || settings.IsSettingsFile(file.Name()) {
+			continue
+		}
+		if filepath.Ext(file.Name()) != ".js" {
+			logrus.WithFields(logrus.Fields{
+				"file": file.Name(),
+			}).Debugf("Not a js file, ignored - readFromFile")
+			continue
+		}
 		content, err := ioutil.ReadFile(jsFiltersPath + "/" + file.Name())
 		if err != nil {
 			logrus.WithFields(logrus.Fields{
@@ -46,95 +62,330 @@ func readFromFile(jsFiltersPath string) map[string]string {
 	return jsFilterFunctions
 }
 
-func parseFilterObject(jsFilterFunctions map[string]string) []model.FilterConfig {
+func parseFilterObject(jsFiltersPath string, jsFilterFunctions map[string]string, library *Library) ([]model.FilterConfig, []model.LoadError) {
 	var filterModels []model.FilterConfig
+	var loadErrors []model.LoadError
 
-	fileNamePattern := regexp.MustCompile("^([0-9]{1,3})\\.(request|response)\\.(.*?)\\.js$")
+	// a single VM reads the definitions of all the files, the filter functions are compiled apart by NewFilterJS.
+	// goja reads both ES5 and ES2015+ definitions, whatever the engine the filter runs on
+	js := goja.New()
+	if err := library.gojaRequire(js); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Errorf("Error setting the require function - parseFilterObject")
+	}
 
 	for fileName, jsFunc := range jsFilterFunctions {
 
-		logrusFileField := logrus.Fields{"file": fileName}
+		filterDefinition := model.FilterConfig{File: filepath.Join(jsFiltersPath, fileName)}
+		definitionError := func(field string, err error) {
+			loadErrors = append(loadErrors, definitionLoadError(filterDefinition, field, err))
+		}
 
-		nameProperties := fileNamePattern.FindStringSubmatch(fileName)
-		if nameProperties == nil || len(nameProperties) < 4 {
-			logrus.WithFields(logrusFileField).Errorf("Error file name")
+		funcFilterDefinition, err := js.RunScript(fileName, "(function(){return"+jsFunc+"})()")
+		if err != nil {
+			definitionError("", fmt.Errorf("error on JS object definition : %v", err))
+			continue
+		}
+		if !isDefined(funcFilterDefinition) {
+			definitionError("", fmt.Errorf("the file doesn't define a filter object"))
 			continue
 		}
 
-		order := nameProperties[1]
-		invokeTime := nameProperties[2]
-		name := nameProperties[3]
-
-		js := otto.New()
+		filter := funcFilterDefinition.ToObject(js)
 
-		funcFilterDefinition, err := js.Call("(function(){return"+jsFunc+"})", nil, nil)
+		enabled, err := readMetadata(fileName, filter, &filterDefinition)
 		if err != nil {
-			logrus.WithFields(logrusFileField).Errorf("Error on JS object definition - parseFilterObject")
+			definitionError("", err)
+			continue
+		}
+
+		if !enabled {
+			logrus.WithFields(logrus.Fields{
+				"file":   fileName,
+				"filter": filterDefinition.Name,
+			}).Infof("Filter disabled, not loaded - parseFilterObject")
 			continue
 		}
 
-		filter := funcFilterDefinition.Object()
+		if value := filter.Get("pathPattern"); isDefined(value) {
+			filterDefinition.PathPattern = value.String()
+			filterDefinition.Regex, err = regexp.Compile(filterDefinition.PathPattern)
+			if err != nil {
+				definitionError("pathPattern", err)
+				continue
+			}
+		}
 
-		filterDefinition := model.FilterConfig{}
+		if value := filter.Get("operations"); isDefined(value) {
+			if operations, err := definitionStringList(value); err == nil {
+				filterDefinition.Operations = operations
+			} else {
+				definitionError("operations", err)
+				continue
+			}
+		}
 
-		if invokeTime == "request" {
-			filterDefinition.Invoke = model.Request
-		} else {
-			filterDefinition.Invoke = model.Response
+		if filterDefinition.PathPattern == "" && len(filterDefinition.Operations) == 0 {
+			logrus.WithFields(logrus.Fields{"file": fileName}).Warnf("Neither pathPattern nor operations defined, the filter will match every request - parseFilterObject")
 		}
 
-		oderInt, orderParserError := strconv.Atoi(order)
-		if orderParserError != nil {
-			logrus.WithFields(logrusFileField).Errorf("Error on order int conversion - parseFilterObject")
+		if value := filter.Get("function"); isDefined(value) {
+			filterDefinition.Function = value.String()
+			if index := strings.Index(jsFunc, filterDefinition.Function); index >= 0 {
+				filterDefinition.FunctionLine = strings.Count(jsFunc[:index], "\n") + 1
+				filterDefinition.FunctionColumn = index - strings.LastIndex(jsFunc[:index], "\n")
+			}
+		} else {
+			definitionError("", fmt.Errorf("the filter function is missing"))
 			continue
 		}
-		filterDefinition.Order = oderInt
-		filterDefinition.Name = name
-
-		if value, err := filter.Get("pathPattern"); err == nil {
-			if value, err := value.ToString(); err == nil {
-				filterDefinition.PathPattern = value
-				filterDefinition.Regex, err = regexp.Compile(value)
-				if err != nil {
-					logrus.WithFields(logrus.Fields{
-						"plugin_name": filterDefinition.Name,
-						"error": err.Error(),
-					}).Errorf("Error compiling the filter url matcher regex")
-				}
+
+		if value := filter.Get("engine"); isDefined(value) {
+			filterDefinition.Engine = value.String()
+		}
+
+		if value := filter.Get("methods"); isDefined(value) {
+			if methods, err := definitionStringList(value); err == nil {
+				filterDefinition.Methods = methods
 			} else {
-				logrus.WithFields(logrus.Fields{
-					"file": fileName,
-					"field": "pathPattern",
-					"error": err.Error(),
-				}).Errorf("Error on JS filter definition - parseFilterObject")
+				definitionError("methods", err)
+				continue
 			}
-		} else {
-			logrus.WithFields(logrus.Fields{
-				"file": fileName,
-				"field": "pathPattern",
-				"error": err.Error(),
-			}).Errorf("Error on JS filter definition - parseFilterObject")
 		}
 
-		if value, err := filter.Get("function"); err == nil {
-			if value, err := value.ToString(); err == nil {
-				filterDefinition.Function = value
+		if value := filter.Get("headers"); isDefined(value) {
+			if headers, err := definitionStringMap(value); err == nil {
+				filterDefinition.Headers = headers
 			} else {
-				logrus.WithFields(logrus.Fields{
-					"file": fileName,
-					"field": "function",
-					"error": err.Error(),
-				}).Errorf("Error on JS filter definition - parseFilterObject")
+				definitionError("headers", err)
+				continue
+			}
+		}
+
+		if value := filter.Get("query"); isDefined(value) {
+			if query, err := definitionStringMap(value); err == nil {
+				filterDefinition.Query = query
+			} else {
+				definitionError("query", err)
+				continue
+			}
+		}
+
+		if value := filter.Get("timeout"); isDefined(value) {
+			if value.ToInteger() < 0 {
+				definitionError("timeout", fmt.Errorf("%d is negative", value.ToInteger()))
+				continue
+			}
+			filterDefinition.Timeout = time.Duration(value.ToInteger()) * time.Millisecond
+		}
+
+		if value := filter.Get("cpuBudget"); isDefined(value) {
+			filterDefinition.CPUBudget = time.Duration(value.ToInteger()) * time.Millisecond
+		}
+
+		if value := filter.Get("onFailure"); isDefined(value) {
+			if policy, err := model.ParseFailurePolicy(value.String()); err == nil {
+				filterDefinition.OnFailure = policy
+			} else {
+				definitionError("onFailure", err)
+				continue
+			}
+		}
+
+		if value := filter.Get("failureStatus"); isDefined(value) {
+			if err := model.CheckStatus(int(value.ToInteger())); err != nil {
+				definitionError("failureStatus", err)
+				continue
+			}
+			filterDefinition.FailureStatus = int(value.ToInteger())
+		}
+
+		if value := filter.Get("failureMessage"); isDefined(value) {
+			filterDefinition.FailureMessage = value.String()
+		}
+
+		if value := filter.Get("mode"); isDefined(value) {
+			if mode, err := model.ParseMode(value.String()); err == nil {
+				filterDefinition.Mode = mode
+			} else {
+				definitionError("mode", err)
+				continue
+			}
+		}
+
+		if value := filter.Get("phase"); isDefined(value) {
+			filterDefinition.Phase = value.String()
+		}
+
+		if value := filter.Get("before"); isDefined(value) {
+			if before, err := definitionStringList(value); err == nil {
+				filterDefinition.Before = before
+			} else {
+				definitionError("before", err)
+				continue
+			}
+		}
+
+		if value := filter.Get("after"); isDefined(value) {
+			if after, err := definitionStringList(value); err == nil {
+				filterDefinition.After = after
+			} else {
+				definitionError("after", err)
+				continue
 			}
-		} else {
-			logrus.WithFields(logrus.Fields{
-				"file": fileName,
-				"field": "function",
-				"error": err.Error(),
-			}).Errorf("Error on JS filter definition - parseFilterObject")
+		}
+
+		if err := filterDefinition.CompileMatchers(); err != nil {
+			definitionError("", err)
+			continue
+		}
+
+		if err := configure(js, filter, &filterDefinition); err != nil {
+			definitionError("", err)
+			continue
 		}
 
 		filterModels = append(filterModels, filterDefinition)
 	}
-	return filterModels
+	return filterModels, loadErrors
+}
+
+// configure reads the settings sidecar file of the filter and hands them to its optional configure function.
+// configure validates the settings by throwing an error, and can return the settings to use, with defaults applied
+func configure(js *goja.Runtime, filter *goja.Object, filterDefinition *model.FilterConfig) error {
+	values, file, err := settings.Load(filterDefinition.File)
+	if err != nil {
+		return fmt.Errorf("error reading the settings file %s : %v", file, err)
+	}
+	if values == nil {
+		values = make(map[string]interface{})
+	}
+	filterDefinition.Settings = values
+
+	configureFunc, ok := goja.AssertFunction(filter.Get("configure"))
+	if !ok {
+		return nil
+	}
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("error encoding the settings : %v", err)
+	}
+	var config interface{}
+	if err := json.Unmarshal(encoded, &config); err != nil {
+		return fmt.Errorf("error decoding the settings : %v", err)
+	}
+	returned, err := configureFunc(goja.Null(), js.ToValue(config))
+	if err != nil {
+		return fmt.Errorf("invalid settings : %v", err)
+	}
+	if !isDefined(returned) {
+		return nil
+	}
+	if _, ok := returned.Export().(map[string]interface{}); !ok {
+		return fmt.Errorf("configure must return an object, got %v", returned)
+	}
+	encodedReturn, err := json.Marshal(returned.Export())
+	if err != nil {
+		return fmt.Errorf("error encoding the settings returned by configure : %v", err)
+	}
+	configured := make(map[string]interface{})
+	if err := json.Unmarshal(encodedReturn, &configured); err != nil {
+		return fmt.Errorf("error decoding the settings returned by configure : %v", err)
+	}
+	filterDefinition.Settings = configured
+	return nil
+}
+
+// isDefined tells if a definition property is set, neither undefined nor null
+func isDefined(value goja.Value) bool {
+	return value != nil && !goja.IsUndefined(value) && !goja.IsNull(value)
+}
+
+// definitionStringList reads an array of strings, a single string is accepted as a one element list
+func definitionStringList(value goja.Value) ([]string, error) {
+	switch exported := value.Export().(type) {
+	case string:
+		return []string{exported}, nil
+	case []interface{}:
+		var list []string
+		for _, item := range exported {
+			list = append(list, fmt.Sprint(item))
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("expected an array of strings, got %v", value)
+}
+
+// definitionStringMap reads an object whose values are strings
+func definitionStringMap(value goja.Value) (map[string]string, error) {
+	exported, ok := value.Export().(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected an object, got %v", value)
+	}
+	values := make(map[string]string)
+	for key, item := range exported {
+		values[key] = fmt.Sprint(item)
+	}
+	return values, nil
+}
+
+// fileNamePattern the {order}.{invoke}.{name}.js file names, whose properties are the defaults of the filter metadata
+var fileNamePattern = regexp.MustCompile("^([0-9]+)\\.(request|response)\\.(.*?)\\.js$")
+
+// readMetadata reads the name, invoke, order and enabled properties of the filter. The file name provides their defaults
+// when it follows the {order}.{invoke}.{name}.js pattern, otherwise the name defaults to the file name and invoke is required
+func readMetadata(fileName string, filter *goja.Object, filterDefinition *model.FilterConfig) (enabled bool, err error) {
+	invokeName := ""
+	filterDefinition.Name = strings.TrimSuffix(fileName, ".js")
+	if nameProperties := fileNamePattern.FindStringSubmatch(fileName); nameProperties != nil {
+		if filterDefinition.Order, err = strconv.Atoi(nameProperties[1]); err != nil {
+			return false, fmt.Errorf("invalid order in the file name : %v", err)
+		}
+		invokeName = nameProperties[2]
+		filterDefinition.Name = nameProperties[3]
+	}
+
+	if value := filter.Get("name"); isDefined(value) {
+		if filterDefinition.Name = value.String(); filterDefinition.Name == "" {
+			return false, fmt.Errorf("invalid name : empty")
+		}
+	}
+	if value := filter.Get("invoke"); isDefined(value) {
+		invokeName = value.String()
+	}
+	if invokeName == "" {
+		return false, fmt.Errorf("invoke is missing, declare it as request or response or name the file {order}.{invoke}.{name}.js")
+	}
+	if filterDefinition.Invoke, err = model.ParseInvoke(invokeName); err != nil {
+		return false, fmt.Errorf("invalid invoke : %v", err)
+	}
+	if value := filter.Get("order"); isDefined(value) {
+		order, ok := value.Export().(int64)
+		if !ok {
+			return false, fmt.Errorf("invalid order : expected an integer, got %v", value)
+		}
+		filterDefinition.Order = int(order)
+	}
+	if value := filter.Get("enabled"); isDefined(value) {
+		enabled, ok := value.Export().(bool)
+		if !ok {
+			return false, fmt.Errorf("invalid enabled : expected a boolean, got %v", value)
+		}
+		return enabled, nil
+	}
+	return true, nil
+}
+
+// definitionLoadError the load error of a filter definition, naming the faulty field if any
+func definitionLoadError(filterDefinition model.FilterConfig, field string, err error) model.LoadError {
+	message := err.Error()
+	if field != "" {
+		message = fmt.Sprintf("invalid %s : %s", field, message)
+	}
+	return model.LoadError{
+		File:   filterDefinition.File,
+		Filter: filterDefinition.Name,
+		Error:  message,
+	}
 }
@@ -0,0 +1,283 @@
+package filterjs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+
+	"github.com/dop251/goja"
+	"github.com/kataras/iris"
+	"github.com/labbsr0x/go-horse/plugins"
+	"github.com/robertkrimen/otto"
+	"github.com/sirupsen/logrus"
+)
+
+// nativeFunction a function of the ctx object, implemented once for both engines. The engine adapters export the
+// arguments to Go values, convert the result back to a JS value and throw the returned error
+type nativeFunction func(call nativeCall) (interface{}, error)
+
+// nativeCall the arguments of a native function call, exported to Go values : nil for undefined and null, bool,
+// numbers, string, slices and map[string]interface{}
+type nativeCall struct {
+	arguments []interface{}
+	// text converts an argument to a string, as String(value) does in JS
+	text func(i int) string
+	// plainObject tells if an argument is an object other than a function or an error
+	plainObject func(i int) bool
+}
+
+// Argument the argument, nil if missing
+func (call nativeCall) Argument(i int) interface{} {
+	if i < len(call.arguments) {
+		return call.arguments[i]
+	}
+	return nil
+}
+
+// Defined tells if the argument is neither undefined nor null
+func (call nativeCall) Defined(i int) bool {
+	return call.Argument(i) != nil
+}
+
+// String the argument as a string, "undefined" if missing
+func (call nativeCall) String(i int) string {
+	if i < len(call.arguments) {
+		return call.text(i)
+	}
+	return "undefined"
+}
+
+// Object the argument as an object, nil if it is not one
+func (call nativeCall) Object(i int) map[string]interface{} {
+	object, _ := call.Argument(i).(map[string]interface{})
+	return object
+}
+
+// jsError an error thrown in the filter as a JS error with its own name, like DockerError
+type jsError struct {
+	name    string
+	message string
+}
+
+func (e *jsError) Error() string {
+	return e.message
+}
+
+// throw the error thrown in the filter as a JS error with the given name
+func throw(name string, format string, args ...interface{}) error {
+	return &jsError{name: name, message: fmt.Sprintf(format, args...)}
+}
+
+// errorName the name of the JS error thrown for the error
+func errorName(err error) string {
+	if thrown, ok := err.(*jsError); ok {
+		return thrown.name
+	}
+	return "Error"
+}
+
+// undefinedValue the type of undefined, the result of the native functions returning undefined rather than null
+type undefinedValue struct{}
+
+var undefined = undefinedValue{}
+
+// execution the state of a filter execution shared by its native functions
+type execution struct {
+	logger *logrus.Entry
+	// context canceled with the execution, the calls to the daemon and the HTTP calls are canceled with it
+	context context.Context
+	// interrupts the budget clock, paused during the native calls
+	interrupts *interrupts
+}
+
+// native the native function, not counted in the CPU budget
+func (execution *execution) native(function nativeFunction) nativeFunction {
+	return func(call nativeCall) (interface{}, error) {
+		execution.interrupts.pause()
+		defer execution.interrupts.resume()
+		return function(call)
+	}
+}
+
+// nativeFunctions the functions of the ctx objects of an execution, by object : ctx.http.get is functions["http"]["get"]
+func (filterJs FilterJS) nativeFunctions(ctx iris.Context, execution *execution) map[string]map[string]nativeFunction {
+	objects := map[string]map[string]nativeFunction{
+		"urlParams": urlParamsFunctions(ctx),
+		"http":      filterJs.options.HTTP.functions(execution.context),
+		"docker":    dockerFunctions(execution.context),
+		"store":     storeFunctions(),
+		"crypto":    cryptoFunctions(),
+		"jwt":       jwtFunctions(filepath.Dir(filterJs.File)),
+		"log":       logFunctions(execution.logger),
+		"values":    valuesFunctions(ctx),
+	}
+	for _, functions := range objects {
+		for name, function := range functions {
+			functions[name] = execution.native(function)
+		}
+	}
+	return objects
+}
+
+// nativePlugin the Go plugin injection as a native function
+func nativePlugin(ctx iris.Context, injection plugins.JSNativeInjection) nativeFunction {
+	return func(call nativeCall) (interface{}, error) {
+		return injection.Call(ctx, call.arguments)
+	}
+}
+
+// ottoFunction adapts the native function to otto
+func ottoFunction(function nativeFunction) func(call otto.FunctionCall) otto.Value {
+	return func(call otto.FunctionCall) otto.Value {
+		arguments := make([]interface{}, len(call.ArgumentList))
+		for i, argument := range call.ArgumentList {
+			arguments[i], _ = argument.Export()
+		}
+		result, err := function(nativeCall{
+			arguments: arguments,
+			text:      func(i int) string { return call.ArgumentList[i].String() },
+			plainObject: func(i int) bool {
+				argument := call.ArgumentList[i]
+				return argument.IsObject() && argument.Class() != "Function" && argument.Class() != "Error"
+			},
+		})
+		if err != nil {
+			panic(call.Otto.MakeCustomError(errorName(err), err.Error()))
+		}
+		return ottoValue(call.Otto, result)
+	}
+}
+
+// ottoValue the Go value as an otto value, objects and arrays included, through JSON
+func ottoValue(js *otto.Otto, value interface{}) otto.Value {
+	switch value.(type) {
+	case undefinedValue:
+		return otto.UndefinedValue()
+	case nil:
+		return otto.NullValue()
+	case string, bool, int, int64, float64:
+		result, _ := otto.ToValue(value)
+		return result
+	}
+	encoded, err := json.Marshal(value)
+	if err == nil {
+		var result otto.Value
+		if result, err = js.Call("JSON.parse", nil, string(encoded)); err == nil {
+			return result
+		}
+	}
+	logrus.WithFields(logrus.Fields{
+		"error": err.Error(),
+	}).Errorf("Error converting a Go value to JS - js filter exec")
+	return otto.UndefinedValue()
+}
+
+// native adapts the native function to goja
+func (v *gojaVM) native(function nativeFunction) func(goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
+		arguments := make([]interface{}, len(call.Arguments))
+		for i, argument := range call.Arguments {
+			arguments[i] = argument.Export()
+		}
+		result, err := function(nativeCall{
+			arguments: arguments,
+			text:      func(i int) string { return call.Arguments[i].String() },
+			plainObject: func(i int) bool {
+				object, ok := call.Arguments[i].(*goja.Object)
+				return ok && object.ClassName() != "Function" && object.ClassName() != "Error"
+			},
+		})
+		if err != nil {
+			panic(v.newError(errorName(err), err.Error()))
+		}
+		return v.value(result)
+	}
+}
+
+// value the Go value as a goja value, objects and arrays included, through JSON
+func (v *gojaVM) value(value interface{}) goja.Value {
+	switch value.(type) {
+	case undefinedValue:
+		return goja.Undefined()
+	case nil:
+		return goja.Null()
+	case string, bool, int, int64, float64:
+		return v.runtime.ToValue(value)
+	}
+	encoded, err := json.Marshal(value)
+	if err == nil {
+		var result goja.Value
+		if result, err = v.parse(goja.Undefined(), v.runtime.ToValue(string(encoded))); err == nil {
+			return result
+		}
+	}
+	logrus.WithFields(logrus.Fields{
+		"error": err.Error(),
+	}).Errorf("Error converting a Go value to JS - js filter exec")
+	return goja.Undefined()
+}
+
+// ottoPlugin calls a Go plugin written for otto from goja, converting the arguments and the result through an otto VM
+// created on the first call of such a plugin
+func (v *gojaVM) ottoPlugin(ctx iris.Context, injection plugins.JSContextInjection) nativeFunction {
+	return func(call nativeCall) (result interface{}, err error) {
+		if v.plugins == nil {
+			v.plugins = otto.New()
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				thrown, ok := r.(otto.Value)
+				if !ok || !thrown.IsObject() {
+					panic(r)
+				}
+				name, _ := thrown.Object().Get("name")
+				message, _ := thrown.Object().Get("message")
+				result, err = nil, throw(name.String(), "%s", message.String())
+			}
+		}()
+		arguments := make([]otto.Value, len(call.arguments))
+		for i, argument := range call.arguments {
+			if arguments[i], err = v.plugins.ToValue(argument); err != nil {
+				return nil, err
+			}
+		}
+		value := injection.Set(ctx, otto.FunctionCall{Otto: v.plugins, ArgumentList: arguments})
+		if value.IsUndefined() {
+			return undefined, nil
+		}
+		return value.Export()
+	}
+}
+
+// toFloat the number as a float64, whatever its Go type
+func toFloat(value interface{}) (float64, bool) {
+	number := reflect.ValueOf(value)
+	switch number.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return number.Float(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(number.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(number.Uint()), true
+	}
+	return 0, false
+}
+
+// toStringList the array as a list of strings, a single value as a one element list. otto exports the arrays whose
+// items share a type as typed slices
+func toStringList(value interface{}) []string {
+	if value == nil {
+		return nil
+	}
+	list := reflect.ValueOf(value)
+	if list.Kind() != reflect.Slice {
+		return []string{fmt.Sprint(value)}
+	}
+	values := make([]string, list.Len())
+	for i := range values {
+		values[i] = fmt.Sprint(list.Index(i).Interface())
+	}
+	return values
+}
@@ -0,0 +1,103 @@
+package filterjs
+
+import (
+	"github.com/kataras/iris"
+	"github.com/labbsr0x/go-horse/filters/model"
+	"github.com/labbsr0x/go-horse/prometheus"
+)
+
+// resetSource captures the globals of a fresh VM and returns a function deleting the globals added afterwards,
+// so a filter leaking variables to the global scope doesn't leak them to the next request
+const resetSource = `(function(global) {
+	var keep = {};
+	Object.getOwnPropertyNames(global).forEach(function(name) { keep[name] = true; });
+	return function() {
+		Object.getOwnPropertyNames(global).forEach(function(name) {
+			if (!keep[name]) {
+				delete global[name];
+			}
+		});
+	};
+})(this)`
+
+// vm a JS VM of one of the engines, with the filter function already evaluated
+type vm interface {
+	// exec runs the filter function for the request. It returns errInterrupted when the budget interrupted it and
+	// errCanceled when the execution was canceled
+	exec(filterJs FilterJS, ctx iris.Context, body string, execution *execution) (model.FilterReturn, error)
+	// interrupt stops the running filter function, exec then returns the error of the interrupt sentinel
+	interrupt(sentinel interface{})
+	// clearInterrupt discards an interrupt that came after the filter function returned
+	clearInterrupt()
+	// reset deletes the globals created by the filter function
+	reset() error
+}
+
+// vmPool bounded pool of the VMs of a filter. VMs are created on demand, up to size, then executions wait for a free one
+type vmPool struct {
+	name    string
+	newVM   func() (vm, error)
+	idle    chan vm
+	created chan struct{}
+}
+
+func newVMPool(name string, newVM func() (vm, error), size int) *vmPool {
+	if size < 1 {
+		size = 1
+	}
+	prometheus.GetMetrics().JSPoolSize.WithLabelValues(name).Set(0)
+	return &vmPool{
+		name:    name,
+		newVM:   newVM,
+		idle:    make(chan vm, size),
+		created: make(chan struct{}, size),
+	}
+}
+
+// acquire takes an idle VM, creates one if the pool is not full, or waits for one to be released until cancel is closed
+func (p *vmPool) acquire(cancel <-chan struct{}) (vm, error) {
+	metrics := prometheus.GetMetrics()
+	select {
+	case instance := <-p.idle:
+		metrics.JSPoolHits.WithLabelValues(p.name).Inc()
+		return instance, nil
+	default:
+	}
+	select {
+	case p.created <- struct{}{}:
+		instance, err := p.newVM()
+		if err != nil {
+			<-p.created
+			return nil, err
+		}
+		metrics.JSPoolSize.WithLabelValues(p.name).Set(float64(len(p.created)))
+		return instance, nil
+	default:
+	}
+	metrics.JSPoolWaits.WithLabelValues(p.name).Inc()
+	select {
+	case instance := <-p.idle:
+		return instance, nil
+	case <-cancel:
+		return nil, errCanceled
+	}
+}
+
+// release resets the globals of the VM and puts it back in the pool
+func (p *vmPool) release(instance vm) {
+	if err := instance.reset(); err != nil {
+		p.discard()
+		return
+	}
+	p.idle <- instance
+}
+
+// discard replaces a VM that can't be reused, like an interrupted one, so the executions waiting for a VM still get one
+func (p *vmPool) discard() {
+	replacement, err := p.newVM()
+	if err != nil {
+		<-p.created
+		return
+	}
+	p.idle <- replacement
+}
@@ -0,0 +1,203 @@
+package filterjs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/dop251/goja"
+	"github.com/robertkrimen/otto"
+	"github.com/sirupsen/logrus"
+)
+
+// LibDir folder of the JS filters directory holding the modules the filters can require
+const LibDir = "lib"
+
+// Library the CommonJS modules of the lib folder. Sources are read once per filters load and compiled once per engine,
+// the modules are evaluated once per VM
+type Library struct {
+	sources map[string]string
+	mutex   sync.Mutex
+	otto    map[string]*otto.Script
+	goja    map[string]*goja.Program
+}
+
+// LoadLibrary reads the modules of the lib folder of the JS filters directory, in any depth
+func LoadLibrary(jsFiltersPath string) *Library {
+	library := &Library{
+		sources: make(map[string]string),
+		otto:    make(map[string]*otto.Script),
+		goja:    make(map[string]*goja.Program),
+	}
+	root := filepath.Join(jsFiltersPath, LibDir)
+	err := filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(file) != ".js" {
+			return nil
+		}
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(filepath.ToSlash(relative), ".js")
+		library.sources[name] = string(content)
+		logrus.WithFields(logrus.Fields{
+			"module": name,
+		}).Debugf("js library module - LoadLibrary")
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Errorf("Error reading the JS library dir - LoadLibrary")
+	}
+	return library
+}
+
+// moduleName the module path relative to the lib folder : acl-utils, ./acl-utils and acl-utils.js are the same module
+func moduleName(name string) (string, error) {
+	cleaned := path.Clean(strings.TrimSuffix(name, ".js"))
+	if cleaned == "." || path.IsAbs(cleaned) || strings.HasPrefix(cleaned, "../") || cleaned == ".." {
+		return "", fmt.Errorf("invalid module name %q, modules are required by their path in the %s folder", name, LibDir)
+	}
+	return cleaned, nil
+}
+
+// wrap the module source in a CommonJS function
+func wrapModule(source string) string {
+	return "(function(exports, require, module) {" + source + "\n})"
+}
+
+func (l *Library) source(name string) (string, error) {
+	if l == nil {
+		return "", fmt.Errorf("cannot find module %q", name)
+	}
+	source, ok := l.sources[name]
+	if !ok {
+		return "", fmt.Errorf("cannot find module %q in the %s folder", name, LibDir)
+	}
+	return source, nil
+}
+
+func (l *Library) ottoScript(name string) (*otto.Script, error) {
+	source, err := l.source(name)
+	if err != nil {
+		return nil, err
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if script, ok := l.otto[name]; ok {
+		return script, nil
+	}
+	script, err := otto.New().Compile(path.Join(LibDir, name+".js"), wrapModule(source))
+	if err != nil {
+		return nil, err
+	}
+	l.otto[name] = script
+	return script, nil
+}
+
+func (l *Library) gojaProgram(name string) (*goja.Program, error) {
+	source, err := l.source(name)
+	if err != nil {
+		return nil, err
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if program, ok := l.goja[name]; ok {
+		return program, nil
+	}
+	program, err := goja.Compile(path.Join(LibDir, name+".js"), wrapModule(source), false)
+	if err != nil {
+		return nil, err
+	}
+	l.goja[name] = program
+	return program, nil
+}
+
+// ottoRequire sets the require function of an otto VM, with its own modules cache
+func (l *Library) ottoRequire(js *otto.Otto) error {
+	modules := make(map[string]*otto.Object)
+	return js.Set("require", func(call otto.FunctionCall) otto.Value {
+		fail := func(err error) {
+			panic(call.Otto.MakeCustomError("RequireError", err.Error()))
+		}
+		name, err := moduleName(call.Argument(0).String())
+		if err != nil {
+			fail(err)
+		}
+		if module, ok := modules[name]; ok {
+			exports, _ := module.Get("exports")
+			return exports
+		}
+		script, err := l.ottoScript(name)
+		if err != nil {
+			fail(err)
+		}
+		wrapper, err := js.Run(script)
+		if err != nil {
+			fail(fmt.Errorf("error loading module %s : %v", name, err))
+		}
+		module, _ := js.Object("({exports: {}})")
+		// cached before running, so modules requiring each other get the exports defined so far
+		modules[name] = module
+		exports, _ := module.Get("exports")
+		require, _ := js.Get("require")
+		if _, err := wrapper.Call(otto.UndefinedValue(), exports, require, module); err != nil {
+			delete(modules, name)
+			fail(fmt.Errorf("error loading module %s : %v", name, err))
+		}
+		exports, _ = module.Get("exports")
+		return exports
+	})
+}
+
+// gojaRequire sets the require function of a goja VM, with its own modules cache
+func (l *Library) gojaRequire(runtime *goja.Runtime) error {
+	modules := make(map[string]*goja.Object)
+	var require func(call goja.FunctionCall) goja.Value
+	require = func(call goja.FunctionCall) goja.Value {
+		fail := func(err error) {
+			errorObj, _ := runtime.New(runtime.Get("Error"), runtime.ToValue(err.Error()))
+			_ = errorObj.Set("name", "RequireError")
+			panic(errorObj)
+		}
+		name, err := moduleName(call.Argument(0).String())
+		if err != nil {
+			fail(err)
+		}
+		if module, ok := modules[name]; ok {
+			return module.Get("exports")
+		}
+		program, err := l.gojaProgram(name)
+		if err != nil {
+			fail(err)
+		}
+		wrapper, err := runtime.RunProgram(program)
+		if err != nil {
+			fail(fmt.Errorf("error loading module %s : %v", name, err))
+		}
+		function, _ := goja.AssertFunction(wrapper)
+		module := runtime.NewObject()
+		exports := runtime.NewObject()
+		_ = module.Set("exports", exports)
+		// cached before running, so modules requiring each other get the exports defined so far
+		modules[name] = module
+		if _, err := function(goja.Undefined(), exports, runtime.Get("require"), module); err != nil {
+			delete(modules, name)
+			fail(fmt.Errorf("error loading module %s : %v", name, err))
+		}
+		return module.Get("exports")
+	}
+	return runtime.Set("require", require)
+}
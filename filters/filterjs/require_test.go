@@ -0,0 +1,60 @@
+package filterjs
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRequire(t *testing.T) {
+	library := map[string]string{
+		"lib/a.js":          `exports.loaded = true; exports.fromB = require("b").sawA;`,
+		"lib/b.js":          `exports.sawA = require("./a").loaded === true;`,
+		"lib/acl/images.js": `exports.allowed = ["nginx"];`,
+	}
+	tests := []struct {
+		name     string
+		function string
+		err      string
+	}{
+		{
+			name:     "cycle",
+			function: `function(ctx) { return {next: require("a").fromB}; }`,
+		},
+		{
+			name:     "cache",
+			function: `function(ctx) { require("acl/images").allowed.push("redis"); return {next: require("./acl/images.js").allowed.length === 2}; }`,
+		},
+		{
+			name:     "missing module",
+			function: `function(ctx) { return {next: require("c")}; }`,
+			err:      `RequireError: cannot find module "c" in the lib folder`,
+		},
+		{
+			name:     "outside the lib folder",
+			function: `function(ctx) { return {next: require("../acl")}; }`,
+			err:      `RequireError: invalid module name "../acl"`,
+		},
+	}
+	for _, engine := range engines {
+		for _, test := range tests {
+			t.Run(engine+"/"+test.name, func(t *testing.T) {
+				files := map[string]string{"acl.js": requestFilter(test.function)}
+				for name, source := range library {
+					files[name] = source
+				}
+				dir := writeFilters(t, files)
+				defer os.RemoveAll(dir)
+				filter := loadFilter(t, dir, engine, Options{})
+
+				result, err := filter.Exec(newContext("", ""), "")
+				if test.err == "" && (err != nil || !result.Next) {
+					t.Fatalf("expected next, got %+v and %v", result, err)
+				}
+				if !strings.Contains(errorString(err), test.err) {
+					t.Fatalf("expected the error %q, got %v", test.err, err)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package filterjs
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/labbsr0x/go-horse/filters/model"
+)
+
+// Options execution options, sandbox limits and library of the JS filters
+type Options struct {
+	// Engine engine of the filters that don't declare one, EngineOtto if empty
+	Engine string
+	// PoolSize maximum number of VMs per filter
+	PoolSize int
+	// CPUBudget time a filter can spend running JS before its VM is interrupted, unless the filter sets its own. The native
+	// calls, like ctx.http, are not counted. No budget if zero
+	CPUBudget time.Duration
+	// MaxResultSize maximum size in bytes of the bodies returned by a filter. No limit if zero
+	MaxResultSize int
+	// DeniedGlobals globals replaced by a function throwing an error in the filters VMs
+	DeniedGlobals []string
+	// Library modules the filters can require
+	Library *Library
+	// HTTP client of ctx.http and ctx.request
+	HTTP *HTTPClient
+	// CaptureConsole sends the console output of the filters to the log, tagged like ctx.log
+	CaptureConsole bool
+}
+
+// ProtectedGlobals globals go-horse itself uses in the filters VMs, they can't be denied
+var ProtectedGlobals = map[string]bool{"JSON": true, "Object": true}
+
+// deniedGlobalError name of the error thrown by the denied globals
+const deniedGlobalError = "DeniedGlobalError"
+
+// budgetExceeded and execCanceled sentinels of the VM interrupts
+type budgetExceeded struct{}
+type execCanceled struct{}
+
+var (
+	// errInterrupted returned by a VM interrupted by the CPU budget
+	errInterrupted = errors.New("filter interrupted")
+	// errCanceled returned by a canceled execution
+	errCanceled = errors.New("filter canceled")
+)
+
+// interruptError the error of the VM interrupt sentinel, nil if the value is not one
+func interruptError(value interface{}) error {
+	switch value.(type) {
+	case budgetExceeded:
+		return errInterrupted
+	case execCanceled:
+		return errCanceled
+	}
+	return nil
+}
+
+// interrupts watches the CPU budget and the cancellation of an execution. The budget only counts the time spent
+// running JS : the clock is paused during the native calls, like ctx.http and ctx.docker, which have their own timeouts
+type interrupts struct {
+	mutex     sync.Mutex
+	timer     *time.Timer
+	remaining time.Duration
+	resumed   time.Time
+	// native depth of the native calls in progress, the clock runs at 0
+	native  int
+	fired   bool
+	stopped chan struct{}
+	done    chan struct{}
+}
+
+// watchInterrupts calls interrupt with the sentinel once the budget is spent or when cancel is closed, whichever comes
+// first. No budget if zero
+func watchInterrupts(budget time.Duration, cancel <-chan struct{}, interrupt func(sentinel interface{})) *interrupts {
+	w := &interrupts{remaining: budget, resumed: time.Now(), stopped: make(chan struct{}), done: make(chan struct{})}
+	var spent <-chan time.Time
+	if budget > 0 {
+		w.timer = time.NewTimer(budget)
+		spent = w.timer.C
+	}
+	go func() {
+		defer close(w.done)
+		select {
+		case <-spent:
+			w.mutex.Lock()
+			w.fired = true
+			w.mutex.Unlock()
+			interrupt(budgetExceeded{})
+		case <-cancel:
+			interrupt(execCanceled{})
+		case <-w.stopped:
+		}
+	}()
+	return w
+}
+
+// pause stops the budget clock while a native function runs
+func (w *interrupts) pause() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.native++
+	if w.native > 1 || w.timer == nil || w.fired {
+		return
+	}
+	if w.timer.Stop() {
+		w.remaining -= time.Since(w.resumed)
+	} else {
+		w.fired = true
+	}
+}
+
+// resume restarts the budget clock once the native function returned
+func (w *interrupts) resume() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.native--
+	if w.native > 0 || w.timer == nil || w.fired {
+		return
+	}
+	w.resumed = time.Now()
+	w.timer.Reset(w.remaining)
+}
+
+// stop stops watching, waiting for a pending interrupt call
+func (w *interrupts) stop() {
+	close(w.stopped)
+	<-w.done
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+}
+
+func deniedGlobalMessage(name, filterName string) string {
+	return fmt.Sprintf("%s is denied in go-horse filters (filter %s)", name, filterName)
+}
+
+// budget the CPU budget of the filter
+func (filterJs FilterJS) budget() time.Duration {
+	if filterJs.CPUBudget > 0 {
+		return filterJs.CPUBudget
+	}
+	return filterJs.options.CPUBudget
+}
+
+// checkResultSize fails when a body returned by the filter is over the size limit
+func (filterJs FilterJS) checkResultSize(what string, value string) error {
+	if filterJs.options.MaxResultSize <= 0 || len(value) <= filterJs.options.MaxResultSize {
+		return nil
+	}
+	return &model.LimitError{
+		Filter: filterJs.Name,
+		Limit:  "result size",
+		Detail: fmt.Sprintf("returned a %s of %d bytes, over the %d bytes limit", what, len(value), filterJs.options.MaxResultSize),
+	}
+}
@@ -0,0 +1,97 @@
+package filterjs
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/labbsr0x/go-horse/filters/model"
+	"github.com/robertkrimen/otto"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// errorHeaderPattern first line of a JS error trace : "TypeError: message"
+	errorHeaderPattern = regexp.MustCompile(`(?s)^([A-Za-z_$][\w$]*(?:Error|Exception)): (.*)$`)
+	// stackFramePattern a stack frame of otto ("at inner (acl.js:3:29)") or goja ("at inner (acl.js:3:35(3))")
+	stackFramePattern = regexp.MustCompile(`^at (?:(.*) \()?(.+):(\d+):(\d+)(?:\(\d+\))?\)?$`)
+)
+
+// scriptError the error thrown by the filter function, located in the filter file
+func (filterJs FilterJS) scriptError(err error) *model.ScriptError {
+	trace := err.Error()
+	switch thrown := err.(type) {
+	case *otto.Error:
+		trace = thrown.String()
+	case *goja.Exception:
+		trace = thrown.String()
+	}
+
+	scriptErr := &model.ScriptError{Filter: filterJs.Name, File: filterJs.File}
+	var header []string
+	for _, line := range strings.Split(strings.TrimRight(trace, "\n"), "\n") {
+		frame := stackFramePattern.FindStringSubmatch(strings.TrimSpace(line))
+		if frame == nil {
+			if len(scriptErr.Stack) == 0 {
+				header = append(header, line)
+			}
+			continue
+		}
+		function, file := frame[1], frame[2]
+		lineNumber, _ := strconv.Atoi(frame[3])
+		column, _ := strconv.Atoi(frame[4])
+		if file == filterJs.File {
+			lineNumber, column = filterJs.filePosition(lineNumber, column)
+			if scriptErr.Line == 0 {
+				scriptErr.Line, scriptErr.Column = lineNumber, column
+			}
+		}
+		location := fmt.Sprintf("%s:%d:%d", file, lineNumber, column)
+		if function != "" {
+			location = fmt.Sprintf("%s (%s)", function, location)
+		}
+		scriptErr.Stack = append(scriptErr.Stack, location)
+	}
+
+	scriptErr.Message = strings.Join(header, "\n")
+	if match := errorHeaderPattern.FindStringSubmatch(scriptErr.Message); match != nil {
+		scriptErr.Name, scriptErr.Message = match[1], match[2]
+	}
+	return scriptErr
+}
+
+// filePosition the position in the filter file of a position in the filter function, compiled wrapped in parentheses
+func (filterJs FilterJS) filePosition(line, column int) (int, int) {
+	if filterJs.FunctionLine == 0 {
+		return line, column
+	}
+	if line == 1 {
+		column += filterJs.FunctionColumn - 2
+	}
+	return line + filterJs.FunctionLine - 1, column
+}
+
+// logScriptError logs the error thrown by a filter with its location and stack
+func logScriptError(scriptErr *model.ScriptError) {
+	message := scriptErr.Message
+	if scriptErr.Name != "" {
+		message = scriptErr.Name + ": " + message
+	}
+	logrus.WithFields(logrus.Fields{
+		"plugin_name": scriptErr.Filter,
+		"file":        scriptErr.File,
+		"line":        scriptErr.Line,
+		"column":      scriptErr.Column,
+		"error":       message,
+		"stack":       strings.Join(scriptErr.Stack, "\n"),
+	}).Errorf("Error executing filter - js filter exec")
+}
+
+// errorBody a Docker error body : {"message": "..."}
+func errorBody(message string) string {
+	encoded, _ := json.Marshal(map[string]string{"message": message})
+	return string(encoded)
+}
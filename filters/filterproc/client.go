@@ -0,0 +1,130 @@
+package filterproc
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/labbsr0x/go-horse/filters/filterproc/sdk"
+)
+
+// errClosed returned by the calls of a closed connection
+var errClosed = errors.New("the connection to the filter process is closed")
+
+// errCanceled returned by the calls canceled before the filter process answered, the answer is ignored
+var errCanceled = errors.New("the call to the filter process was canceled")
+
+// maxMessageSize maximum size of a message, bodies included
+const maxMessageSize = 64 * 1024 * 1024
+
+// client a JSON-RPC 2.0 client of a filter process, the calls are multiplexed on a single connection
+type client struct {
+	conn       net.Conn
+	writeMutex sync.Mutex
+	mutex      sync.Mutex
+	nextID     uint64
+	pending    map[uint64]chan sdk.RPCResponse
+	closed     chan struct{}
+	closeOnce  sync.Once
+}
+
+// dial connects to the socket of the filter process, waiting for it to listen until the deadline or until exited is closed
+func dial(socket string, deadline time.Time, exited <-chan struct{}) (*client, error) {
+	for {
+		conn, err := net.Dial("unix", socket)
+		if err == nil {
+			c := &client{conn: conn, pending: make(map[uint64]chan sdk.RPCResponse), closed: make(chan struct{})}
+			go c.read()
+			return c, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("the filter process didn't listen on %s : %v", socket, err)
+		}
+		select {
+		case <-exited:
+			return nil, errors.New("the filter process exited before listening")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+func (c *client) read() {
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	for scanner.Scan() {
+		var response sdk.RPCResponse
+		if err := json.Unmarshal(scanner.Bytes(), &response); err != nil {
+			break
+		}
+		c.mutex.Lock()
+		pending, ok := c.pending[response.ID]
+		delete(c.pending, response.ID)
+		c.mutex.Unlock()
+		if ok {
+			pending <- response
+		}
+	}
+	c.close()
+}
+
+// call the method, decoding its result in result, within the timeout or until cancel is closed
+func (c *client) call(method string, params, result interface{}, timeout time.Duration, cancel <-chan struct{}) error {
+	encodedParams, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	done := make(chan sdk.RPCResponse, 1)
+	c.mutex.Lock()
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = done
+	c.mutex.Unlock()
+	defer func() {
+		c.mutex.Lock()
+		delete(c.pending, id)
+		c.mutex.Unlock()
+	}()
+
+	encoded, err := json.Marshal(sdk.RPCRequest{JSONRPC: "2.0", ID: id, Method: method, Params: encodedParams})
+	if err != nil {
+		return err
+	}
+	c.writeMutex.Lock()
+	_, err = c.conn.Write(append(encoded, '\n'))
+	c.writeMutex.Unlock()
+	if err != nil {
+		c.close()
+		return errClosed
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case response := <-done:
+		if response.Error != nil {
+			return response.Error
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(response.Result, result)
+	case <-c.closed:
+		return errClosed
+	case <-timer.C:
+		return fmt.Errorf("%s didn't answer within %v", method, timeout)
+	case <-cancel:
+		return errCanceled
+	}
+}
+
+func (c *client) close() {
+	c.closeOnce.Do(func() {
+		_ = c.conn.Close()
+		close(c.closed)
+	})
+}
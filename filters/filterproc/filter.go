@@ -0,0 +1,168 @@
+package filterproc
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kataras/iris"
+	"github.com/labbsr0x/go-horse/dockerapi"
+	"github.com/labbsr0x/go-horse/filters/filterproc/sdk"
+	"github.com/labbsr0x/go-horse/filters/model"
+	"github.com/labbsr0x/go-horse/util"
+)
+
+// FilterProc a filter running in its own process
+type FilterProc struct {
+	process *process
+}
+
+// MatchURL proc
+func (filterProc FilterProc) MatchURL(ctx iris.Context) bool {
+	config := filterProc.Config()
+	return config.Regex == nil || config.Regex.MatchString(ctx.RequestPath(false))
+}
+
+// Config the config read from the filter process when it last started
+func (filterProc FilterProc) Config() model.FilterConfig {
+	if config := filterProc.process.Config(); config != nil {
+		return *config
+	}
+	return model.FilterConfig{File: filterProc.process.file}
+}
+
+// Exec sends the request to the filter process
+func (filterProc FilterProc) Exec(ctx iris.Context, body string) (model.FilterReturn, error) {
+	return filterProc.ExecCancelable(ctx, body, nil)
+}
+
+// ExecCancelable sends the request to the filter process, abandoning the call when cancel is closed
+func (filterProc FilterProc) ExecCancelable(ctx iris.Context, body string, cancel <-chan struct{}) (model.FilterReturn, error) {
+	config := filterProc.Config()
+	c, err := filterProc.process.current()
+	if err != nil {
+		return model.FilterReturn{Next: false}, &model.UnavailableError{Filter: config.Name, Detail: err.Error()}
+	}
+
+	dockerOperation := dockerapi.FromContext(ctx)
+	request := sdk.Request{
+		Method:             strings.ToUpper(ctx.Method()),
+		URL:                ctx.Request().URL.Path,
+		Query:              ctx.Request().URL.Query(),
+		Headers:            ctx.Request().Header,
+		Body:               body,
+		OperationID:        dockerOperation.ID,
+		APIVersion:         dockerOperation.Version,
+		PathParams:         dockerOperation.Params,
+		ResponseStatusCode: ctx.Values().GetIntDefault(util.ResponseStatusCodeKey, 0),
+		Values:             util.RequestScopeValues(ctx),
+	}
+	if !utf8.ValidString(body) {
+		request.Body, request.BodyEncoding = base64.StdEncoding.EncodeToString([]byte(body)), "base64"
+	}
+
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = callTimeout
+	}
+	var result sdk.Result
+	if err := c.call(sdk.MethodExec, request, &result, timeout, cancel); err != nil {
+		if err == errCanceled {
+			return model.FilterReturn{Next: false}, err
+		}
+		if _, filterErr := err.(*sdk.RPCError); filterErr {
+			return model.FilterReturn{Next: false}, fmt.Errorf("filter %s : %v", config.Name, err)
+		}
+		return model.FilterReturn{Next: false}, &model.UnavailableError{Filter: config.Name, Detail: err.Error()}
+	}
+	return filterReturn(ctx, result)
+}
+
+// filterReturn the filter return of the result of the filter process
+func filterReturn(ctx iris.Context, result sdk.Result) (model.FilterReturn, error) {
+	filterReturn := model.FilterReturn{Next: result.Next, Status: result.Status, Operation: model.Read}
+	if result.Body != nil {
+		filterReturn.Body, filterReturn.Operation = *result.Body, model.Write
+		if result.BodyEncoding == "base64" {
+			decoded, err := base64.StdEncoding.DecodeString(*result.Body)
+			if err != nil {
+				return model.FilterReturn{Next: false}, fmt.Errorf("the base64 body of the filter result is invalid : %v", err)
+			}
+			filterReturn.Body = string(decoded)
+		}
+	}
+	if result.Headers != nil {
+		filterReturn.Headers = model.HeaderOperations{Set: result.Headers.Set, Remove: result.Headers.Remove}
+	}
+	if result.Response != nil {
+		filterReturn.Response = &model.SyntheticResponse{
+			Status:      result.Response.Status,
+			Headers:     result.Response.Headers,
+			ContentType: result.Response.ContentType,
+			Body:        result.Response.Body,
+		}
+		if err := filterReturn.Response.CheckStatus(); err != nil {
+			return model.FilterReturn{Next: false}, err
+		}
+	}
+	for key, value := range result.Values {
+		if err := util.RequestScopeSet(ctx, key, value); err != nil {
+			return model.FilterReturn{Next: false}, err
+		}
+	}
+	if result.Error != "" {
+		filterReturn.Err = errors.New(result.Error)
+	}
+	return filterReturn, filterReturn.Err
+}
+
+// filterConfig the filter config of the config returned by the filter process
+func filterConfig(definition sdk.Config, file string) (model.FilterConfig, error) {
+	config := model.FilterConfig{
+		Name:           definition.Name,
+		Order:          definition.Order,
+		PathPattern:    definition.PathPattern,
+		Operations:     definition.Operations,
+		Methods:        definition.Methods,
+		Headers:        definition.Headers,
+		Query:          definition.Query,
+		Timeout:        time.Duration(definition.Timeout) * time.Millisecond,
+		FailureStatus:  definition.FailureStatus,
+		FailureMessage: definition.FailureMessage,
+		Phase:          definition.Phase,
+		Before:         definition.Before,
+		After:          definition.After,
+		File:           file,
+	}
+	if config.Name == "" {
+		config.Name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
+
+	var err error
+	if config.Invoke, err = model.ParseInvoke(definition.Invoke); err != nil {
+		return config, fmt.Errorf("invalid invoke : %v", err)
+	}
+	if config.OnFailure, err = model.ParseFailurePolicy(definition.OnFailure); err != nil {
+		return config, fmt.Errorf("invalid onFailure : %v", err)
+	}
+	if config.Mode, err = model.ParseMode(definition.Mode); err != nil {
+		return config, fmt.Errorf("invalid mode : %v", err)
+	}
+	if err := config.CheckFailurePolicy(); err != nil {
+		return config, err
+	}
+	if config.PathPattern != "" {
+		if config.Regex, err = regexp.Compile(config.PathPattern); err != nil {
+			return config, fmt.Errorf("invalid pathPattern : %v", err)
+		}
+	}
+	if err := config.CompileMatchers(); err != nil {
+		return config, err
+	}
+	return config, nil
+}
@@ -0,0 +1,192 @@
+package filterproc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labbsr0x/go-horse/filters/model"
+	"github.com/labbsr0x/go-horse/filters/settings"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	registryMutex sync.Mutex
+	// processes the filter processes by executable file, they outlive the filters reloads
+	processes = make(map[string]*process)
+	// pending the processes of the changed executables, replacing the running ones once started
+	pending = make(map[string]*process)
+	// socketDir directory of the sockets of the filter processes
+	socketDir string
+	// startedHandler called when a filter process left out of the filter chain finally starts
+	startedHandler func()
+)
+
+// OnLateStart sets the function called when a filter process starts after the filters load, to load the filters
+// again and add it to the filter chain
+func OnLateStart(handler func()) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	startedHandler = handler
+}
+
+func notifyStarted() {
+	registryMutex.Lock()
+	handler := startedHandler
+	registryMutex.Unlock()
+	if handler != nil {
+		handler()
+	}
+}
+
+// Load starts the executables of the directory not started yet, restarts the changed ones and stops the removed ones,
+// then returns the filters of the running processes, along with the errors of the processes that failed to start.
+// Load doesn't wait for the processes to start, they join the filter chain on the next load, requested with OnLateStart.
+// A changed executable is started next to the running process, which stays in the filter chain until its new
+// version started. The running processes are configured again with their current settings
+func Load(processFiltersPath string) ([]FilterProc, []model.LoadError) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if processFiltersPath == "" {
+		stopAll()
+		return nil, nil
+	}
+	files, err := ioutil.ReadDir(processFiltersPath)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Errorf("Could not load process filters from directory")
+		return nil, []model.LoadError{{File: processFiltersPath, Error: fmt.Sprintf("could not read the process filters directory : %v", err)}}
+	}
+	if socketDir == "" {
+		if socketDir, err = ioutil.TempDir("", "go-horse-filters"); err != nil {
+			return nil, []model.LoadError{{File: processFiltersPath, Error: fmt.Sprintf("could not create the sockets directory : %v", err)}}
+		}
+	}
+
+	found := make(map[string]bool)
+	for _, info := range files {
+		if info.IsDir() || info.Mode()&0111 == 0 || strings.HasPrefix(info.Name(), ".") || settings.IsSettingsFile(info.Name()) {
+			continue
+		}
+		file := filepath.Join(processFiltersPath, info.Name())
+		found[file] = true
+		existing, next := processes[file], pending[file]
+		if next != nil && !next.modTime.Equal(info.ModTime()) {
+			next.shutdown()
+			delete(pending, file)
+			next = nil
+		}
+		if existing != nil && existing.Config() == nil {
+			// never started, nothing to keep running
+			if !existing.modTime.Equal(info.ModTime()) {
+				existing.shutdown()
+				delete(processes, file)
+				existing = nil
+			}
+		}
+		switch {
+		case existing == nil:
+			processes[file] = startProcess(file, info.ModTime())
+		case next == nil && !existing.modTime.Equal(info.ModTime()):
+			logrus.WithFields(logrus.Fields{
+				"file": file,
+			}).Warnf("Filter executable changed, starting its new version")
+			pending[file] = startProcess(file, info.ModTime())
+		case next != nil && next.Config() != nil:
+			logrus.WithFields(logrus.Fields{
+				"file": file,
+			}).Warnf("Filter executable new version started, stopping the previous one")
+			existing.shutdown()
+			processes[file] = next
+			delete(pending, file)
+		}
+	}
+	for file, p := range processes {
+		if !found[file] {
+			p.shutdown()
+			delete(processes, file)
+		}
+	}
+	for file, p := range pending {
+		if !found[file] {
+			p.shutdown()
+			delete(pending, file)
+		}
+	}
+
+	var filters []FilterProc
+	var loadErrors []model.LoadError
+	for file, p := range processes {
+		if p.Config() == nil {
+			// still starting, the process requests a load once it started
+			if err := p.startError(); err != nil {
+				loadErrors = append(loadErrors, model.LoadError{File: file, Error: err.Error()})
+			}
+			continue
+		}
+		if err := p.reconfigure(); err != nil {
+			loadErrors = append(loadErrors, model.LoadError{File: file, Filter: p.Config().Name, Error: err.Error()})
+			continue
+		}
+		filters = append(filters, FilterProc{process: p})
+	}
+	for file, p := range pending {
+		if err := p.startError(); err != nil {
+			loadErrors = append(loadErrors, model.LoadError{File: file, Filter: processes[file].Config().Name,
+				Error: fmt.Sprintf("the new version of the filter executable failed to start, the previous one is kept : %v", err)})
+		}
+	}
+	return filters, loadErrors
+}
+
+// startProcess starts supervising the filter executable, without waiting for it to start
+func startProcess(file string, modTime time.Time) *process {
+	p := newProcess(file, modTime, socketDir)
+	go p.supervise()
+	return p
+}
+
+// WaitStarted waits for the first start attempt of the filter processes started by the last load. It tells if there
+// were processes to wait for
+func WaitStarted() bool {
+	registryMutex.Lock()
+	var starting []*process
+	for _, p := range processes {
+		if p.Config() == nil {
+			starting = append(starting, p)
+		}
+	}
+	for _, p := range pending {
+		starting = append(starting, p)
+	}
+	registryMutex.Unlock()
+
+	deadline := time.Now().Add(startTimeout * 2)
+	for _, p := range starting {
+		p.waitStarted(time.Until(deadline))
+	}
+	return len(starting) > 0
+}
+
+// StopAll stops the filter processes
+func StopAll() {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	stopAll()
+}
+
+func stopAll() {
+	for file, p := range processes {
+		p.shutdown()
+		delete(processes, file)
+	}
+	for file, p := range pending {
+		p.shutdown()
+		delete(pending, file)
+	}
+}
@@ -0,0 +1,274 @@
+package filterproc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labbsr0x/go-horse/filters/filterproc/sdk"
+	"github.com/labbsr0x/go-horse/filters/model"
+	"github.com/labbsr0x/go-horse/filters/settings"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// startTimeout time a filter process has to listen on its socket and answer Filter.Config
+	startTimeout = 10 * time.Second
+	// callTimeout timeout of the calls of the filters without a timeout
+	callTimeout = 30 * time.Second
+	// minBackoff and maxBackoff delays between the restarts of a crashing filter process, doubled on each crash
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
+	// stableAfter a filter process running for that long is restarted without delay when it exits
+	stableAfter = time.Minute
+)
+
+// process a filter executable, spawned and restarted by go-horse
+type process struct {
+	file    string
+	modTime time.Time
+	socket  string
+
+	mutex   sync.Mutex
+	client  *client
+	config  *model.FilterConfig
+	lastErr error
+	// started closed once the first start attempt is over, succeeded or not
+	started   chan struct{}
+	startOnce sync.Once
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+// instances counts the processes created, numbering their sockets
+var instances uint64
+
+func newProcess(file string, modTime time.Time, socketDir string) *process {
+	// each process gets its own socket, the new version of an executable starts while the previous one still runs
+	instance := atomic.AddUint64(&instances, 1)
+	return &process{
+		file:    file,
+		modTime: modTime,
+		socket:  filepath.Join(socketDir, fmt.Sprintf("%s.%d.sock", filepath.Base(file), instance)),
+		started: make(chan struct{}),
+		stop:    make(chan struct{}),
+	}
+}
+
+// supervise runs the filter process, restarting it when it exits, until stopped
+func (p *process) supervise() {
+	backoff := minBackoff
+	for {
+		startedAt := time.Now()
+		err := p.run()
+		p.startOnce.Do(func() { close(p.started) })
+
+		select {
+		case <-p.stop:
+			return
+		default:
+		}
+
+		if time.Since(startedAt) > stableAfter {
+			backoff = minBackoff
+		}
+		logrus.WithFields(logrus.Fields{
+			"file":    p.file,
+			"error":   fmt.Sprintf("%v", err),
+			"restart": backoff.String(),
+		}).Warnf("Filter process exited, restarting it")
+
+		select {
+		case <-p.stop:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// run starts the filter process, connects to it, reads its config and waits for it to exit
+func (p *process) run() error {
+	_ = os.Remove(p.socket)
+	cmd := exec.Command(p.file)
+	cmd.Dir = filepath.Dir(p.file)
+	cmd.Env = append(os.Environ(), sdk.SocketEnv+"="+p.socket, sdk.ProtocolVersionEnv+"="+sdk.ProtocolVersion)
+	output := logrus.WithFields(logrus.Fields{"file": p.file})
+	stdout, stderr := output.WriterLevel(logrus.InfoLevel), output.WriterLevel(logrus.WarnLevel)
+	defer stdout.Close()
+	defer stderr.Close()
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+
+	if err := cmd.Start(); err != nil {
+		return p.failed(fmt.Errorf("error starting the filter process : %v", err))
+	}
+	defer os.Remove(p.socket)
+	exited := make(chan struct{})
+	var waitErr error
+	go func() {
+		waitErr = cmd.Wait()
+		close(exited)
+	}()
+
+	c, err := p.connect(exited)
+	if err != nil {
+		_ = cmd.Process.Kill()
+		<-exited
+		return p.failed(err)
+	}
+	logrus.WithFields(logrus.Fields{
+		"file":   p.file,
+		"filter": p.Config().Name,
+		"pid":    cmd.Process.Pid,
+	}).Infof("Filter process started")
+	p.startOnce.Do(func() { close(p.started) })
+
+	select {
+	case <-exited:
+		c.close()
+	case <-c.closed:
+		_ = cmd.Process.Kill()
+		<-exited
+	case <-p.stop:
+		c.close()
+		_ = cmd.Process.Kill()
+		<-exited
+		return nil
+	}
+	p.mutex.Lock()
+	p.client = nil
+	p.mutex.Unlock()
+	if waitErr == nil {
+		waitErr = errors.New("the filter process exited")
+	}
+	return p.failed(waitErr)
+}
+
+// connect dials the filter process, reads its config and configures it
+func (p *process) connect(exited <-chan struct{}) (*client, error) {
+	c, err := dial(p.socket, time.Now().Add(startTimeout), exited)
+	if err != nil {
+		return nil, err
+	}
+	var definition sdk.Config
+	if err := c.call(sdk.MethodConfig, nil, &definition, startTimeout, nil); err != nil {
+		c.close()
+		return nil, fmt.Errorf("error reading the filter config : %v", err)
+	}
+	config, err := filterConfig(definition, p.file)
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+	if err := configure(c, &config); err != nil {
+		c.close()
+		return nil, err
+	}
+	p.mutex.Lock()
+	firstStart := p.config == nil
+	p.client, p.config, p.lastErr = c, &config, nil
+	p.mutex.Unlock()
+
+	// the filters load doesn't wait for the processes, a process starting for the first time is not in the filter chain yet
+	if firstStart {
+		go notifyStarted()
+	}
+	return c, nil
+}
+
+// configure reads the settings sidecar file of the filter and hands them to the filter process
+func configure(c *client, config *model.FilterConfig) error {
+	values, file, err := settings.Load(config.File)
+	if err != nil {
+		return fmt.Errorf("error reading the settings file %s : %v", file, err)
+	}
+	if values == nil {
+		values = make(map[string]interface{})
+	}
+	if err := c.call(sdk.MethodConfigure, sdk.ConfigureParams{Settings: values}, nil, startTimeout, nil); err != nil {
+		return fmt.Errorf("invalid settings : %v", err)
+	}
+	config.Settings = values
+	return nil
+}
+
+// reconfigure hands the current settings to the running filter process
+func (p *process) reconfigure() error {
+	p.mutex.Lock()
+	c, config := p.client, p.config
+	p.mutex.Unlock()
+	if c == nil || config == nil {
+		return nil
+	}
+	updated := *config
+	if err := configure(c, &updated); err != nil {
+		return err
+	}
+	p.mutex.Lock()
+	p.config = &updated
+	p.mutex.Unlock()
+	return nil
+}
+
+func (p *process) failed(err error) error {
+	p.mutex.Lock()
+	p.lastErr = err
+	p.mutex.Unlock()
+	return err
+}
+
+// Config the config read from the filter process, nil if it never started
+func (p *process) Config() *model.FilterConfig {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.config
+}
+
+// current the client of the running filter process, or the reason why it is not running
+func (p *process) current() (*client, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.client != nil {
+		return p.client, nil
+	}
+	if p.lastErr != nil {
+		return nil, p.lastErr
+	}
+	return nil, errors.New("the filter process is starting")
+}
+
+// startError the reason why the process is not running once its first start attempt is over, nil while it is
+// starting or running
+func (p *process) startError() error {
+	select {
+	case <-p.started:
+	default:
+		return nil
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.client != nil {
+		return nil
+	}
+	return p.lastErr
+}
+
+// waitStarted waits for the first start attempt of the filter process
+func (p *process) waitStarted(timeout time.Duration) {
+	select {
+	case <-p.started:
+	case <-time.After(timeout):
+	}
+}
+
+// shutdown stops supervising the filter process and kills it
+func (p *process) shutdown() {
+	p.stopOnce.Do(func() { close(p.stop) })
+}
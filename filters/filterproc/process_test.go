@@ -0,0 +1,137 @@
+package filterproc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/context"
+	"github.com/labbsr0x/go-horse/filters/filterproc/sdk"
+	"github.com/labbsr0x/go-horse/filters/model"
+)
+
+// TestMain runs the test binary as the filter process when it is spawned by the tests
+func TestMain(m *testing.M) {
+	if os.Getenv(sdk.SocketEnv) != "" {
+		if err := sdk.Serve(&denyImage{}); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+type denyImage struct {
+	image string
+}
+
+func (f *denyImage) Config() sdk.Config {
+	return sdk.Config{Name: "deny-image", Invoke: "request", OnFailure: "deny", FailureStatus: 503}
+}
+
+func (f *denyImage) Configure(settings map[string]interface{}) error {
+	image, ok := settings["image"].(string)
+	if !ok {
+		return fmt.Errorf("image is required")
+	}
+	f.image = image
+	return nil
+}
+
+func (f *denyImage) Exec(request sdk.Request) (sdk.Result, error) {
+	if strings.Contains(request.Body, "crash") {
+		os.Exit(3)
+	}
+	if strings.Contains(request.Body, f.image) {
+		return sdk.Result{Status: 403, Error: f.image + " is not allowed"}, nil
+	}
+	return sdk.Result{Next: true, Values: map[string]interface{}{"checked": true}}, nil
+}
+
+func newContext(body string) iris.Context {
+	ctx := context.NewContext(iris.New())
+	ctx.BeginRequest(httptest.NewRecorder(), httptest.NewRequest("POST", "/containers/create", strings.NewReader(body)))
+	return ctx
+}
+
+func TestProcessFilter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filterproc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer StopAll()
+
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := "#!/bin/sh\nexec " + executable + " -test.run=^$\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "deny-image"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "deny-image.yaml"), []byte("image: redis\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if filters, loadErrors := Load(dir); len(loadErrors) != 0 || len(filters) != 0 {
+		t.Fatalf("expected the filter process to be starting, got %v and errors %v", filters, loadErrors)
+	}
+	if !WaitStarted() {
+		t.Fatal("expected a filter process to wait for")
+	}
+	filters, loadErrors := Load(dir)
+	if len(loadErrors) != 0 || len(filters) != 1 {
+		t.Fatalf("expected a single filter, got %v and errors %v", filters, loadErrors)
+	}
+	filter := filters[0]
+	if config := filter.Config(); config.Name != "deny-image" || config.Invoke != model.Request || config.FailureStatus != 503 {
+		t.Fatalf("unexpected config %+v", config)
+	}
+
+	result, err := filter.Exec(newContext(`{"Image":"redis"}`), `{"Image":"redis"}`)
+	if err == nil || result.Next || result.Status != 403 || err.Error() != "redis is not allowed" {
+		t.Fatalf("expected the request to be denied, got %+v and %v", result, err)
+	}
+	if result, err = filter.Exec(newContext(`{"Image":"nginx"}`), `{"Image":"nginx"}`); err != nil || !result.Next {
+		t.Fatalf("expected the request to be allowed, got %+v and %v", result, err)
+	}
+
+	_, err = filter.Exec(newContext("crash"), "crash")
+	if _, unavailable := err.(*model.UnavailableError); !unavailable {
+		t.Fatalf("expected the filter to be unavailable, got %v", err)
+	}
+
+	deadline := time.Now().Add(startTimeout)
+	for {
+		if result, err = filter.Exec(newContext(`{"Image":"nginx"}`), `{"Image":"nginx"}`); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the filter process to be restarted, got %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	changed := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(dir, "deny-image"), changed, changed); err != nil {
+		t.Fatal(err)
+	}
+	if filters, loadErrors = Load(dir); len(loadErrors) != 0 || len(filters) != 1 || filters[0].process != filter.process {
+		t.Fatalf("expected the running process to stay in the chain, got %v and errors %v", filters, loadErrors)
+	}
+	WaitStarted()
+	if filters, loadErrors = Load(dir); len(loadErrors) != 0 || len(filters) != 1 || filters[0].process == filter.process {
+		t.Fatalf("expected the new process to replace the running one, got %v and errors %v", filters, loadErrors)
+	}
+	if result, err = filters[0].Exec(newContext(`{"Image":"nginx"}`), `{"Image":"nginx"}`); err != nil || !result.Next {
+		t.Fatalf("expected the request to be allowed by the new process, got %+v and %v", result, err)
+	}
+}
@@ -0,0 +1,143 @@
+// Package sdk the protocol of the process filters, and the helpers to write them in Go.
+//
+// A process filter is an executable spawned by go-horse. It listens on the unix socket whose path is given by the
+// GOHORSE_FILTER_SOCKET environment variable, and answers the JSON-RPC 2.0 requests of go-horse, one JSON object
+// per line, with the Filter.Config, Filter.Configure and Filter.Exec methods
+package sdk
+
+import "encoding/json"
+
+const (
+	// SocketEnv environment variable holding the unix socket path the filter must listen on
+	SocketEnv = "GOHORSE_FILTER_SOCKET"
+	// ProtocolVersionEnv environment variable holding the protocol version spoken by go-horse
+	ProtocolVersionEnv = "GOHORSE_FILTER_PROTOCOL"
+	// ProtocolVersion version of the protocol
+	ProtocolVersion = "1"
+)
+
+// Methods called by go-horse
+const (
+	// MethodConfig returns the Config of the filter, called once the filter process is started
+	MethodConfig = "Filter.Config"
+	// MethodConfigure params ConfigureParams, called after Filter.Config and on every filters reload.
+	// An error leaves the filter out
+	MethodConfigure = "Filter.Configure"
+	// MethodExec params Request, returns the Result of the filter
+	MethodExec = "Filter.Exec"
+)
+
+// Error codes of the JSON-RPC errors
+const (
+	// CodeMethodNotFound method not implemented by the filter
+	CodeMethodNotFound = -32601
+	// CodeInvalidParams params that can't be decoded
+	CodeInvalidParams = -32602
+	// CodeFilterError error returned by the filter
+	CodeFilterError = -32000
+)
+
+// Config the definition of the filter, the fields of the JS filters definition
+type Config struct {
+	Name string `json:"name"`
+	// Invoke request or response
+	Invoke      string            `json:"invoke"`
+	Order       int               `json:"order,omitempty"`
+	PathPattern string            `json:"pathPattern,omitempty"`
+	Operations  []string          `json:"operations,omitempty"`
+	Methods     []string          `json:"methods,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Query       map[string]string `json:"query,omitempty"`
+	// Timeout in milliseconds
+	Timeout int `json:"timeout,omitempty"`
+	// OnFailure deny or skip
+	OnFailure      string `json:"onFailure,omitempty"`
+	FailureStatus  int    `json:"failureStatus,omitempty"`
+	FailureMessage string `json:"failureMessage,omitempty"`
+	// Mode enforce or shadow
+	Mode   string   `json:"mode,omitempty"`
+	Phase  string   `json:"phase,omitempty"`
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+}
+
+// ConfigureParams the content of the settings sidecar file of the filter, empty if there is none
+type ConfigureParams struct {
+	Settings map[string]interface{} `json:"settings"`
+}
+
+// Request the request, or the daemon response for the response filters, handed to the filter
+type Request struct {
+	Method string `json:"method"`
+	// URL path of the request
+	URL     string              `json:"url"`
+	Query   map[string][]string `json:"query"`
+	Headers map[string][]string `json:"headers"`
+	// Body the request body, or the daemon response body. Base64 encoded when it is not UTF-8 text
+	Body string `json:"body"`
+	// BodyEncoding base64 when the body is base64 encoded, empty otherwise
+	BodyEncoding string            `json:"bodyEncoding,omitempty"`
+	OperationID  string            `json:"operationId"`
+	APIVersion   string            `json:"apiVersion"`
+	PathParams   map[string]string `json:"pathParams"`
+	// ResponseStatusCode status of the daemon response, response filters only
+	ResponseStatusCode int `json:"responseStatusCode,omitempty"`
+	// Values the request scope values, see ctx.values
+	Values map[string]interface{} `json:"values"`
+}
+
+// Result the result of the filter, the return of the JS filters
+type Result struct {
+	Next bool `json:"next"`
+	// Body replaces the body when set
+	Body *string `json:"body,omitempty"`
+	// BodyEncoding base64 when the body is base64 encoded, empty otherwise
+	BodyEncoding string `json:"bodyEncoding,omitempty"`
+	Status       int    `json:"status,omitempty"`
+	// Error message sent to the client when the filter stops the request
+	Error    string            `json:"error,omitempty"`
+	Headers  *HeaderOperations `json:"headers,omitempty"`
+	Response *Response         `json:"response,omitempty"`
+	// Values request scope values to set for the next filters
+	Values map[string]interface{} `json:"values,omitempty"`
+}
+
+// HeaderOperations headers to set and remove
+type HeaderOperations struct {
+	Set    map[string]string `json:"set,omitempty"`
+	Remove []string          `json:"remove,omitempty"`
+}
+
+// Response a synthetic response, served without calling the daemon. Request filters only
+type Response struct {
+	Status      int               `json:"status"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	ContentType string            `json:"contentType,omitempty"`
+	Body        string            `json:"body,omitempty"`
+}
+
+// RPCRequest a JSON-RPC 2.0 request
+type RPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      uint64          `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// RPCResponse a JSON-RPC 2.0 response
+type RPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      uint64          `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// RPCError a JSON-RPC 2.0 error
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return e.Message
+}
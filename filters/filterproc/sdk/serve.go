@@ -0,0 +1,120 @@
+package sdk
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+)
+
+// Filter a process filter
+type Filter interface {
+	Config() Config
+	Exec(request Request) (Result, error)
+}
+
+// Configurable optional interface of the filters taking settings, see MethodConfigure
+type Configurable interface {
+	Configure(settings map[string]interface{}) error
+}
+
+// maxMessageSize maximum size of a message, bodies included
+const maxMessageSize = 64 * 1024 * 1024
+
+// Serve listens on the socket given by go-horse and serves the filter until go-horse closes the connection.
+// The requests are served concurrently
+func Serve(filter Filter) error {
+	path := os.Getenv(SocketEnv)
+	if path == "" {
+		return fmt.Errorf("%s is not set, the filter must be started by go-horse", SocketEnv)
+	}
+	_ = os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	conn, err := listener.Accept()
+	_ = listener.Close()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return ServeConn(filter, conn)
+}
+
+// ServeConn serves the filter on the connection until it is closed
+func ServeConn(filter Filter, conn io.ReadWriter) error {
+	var writeMutex sync.Mutex
+	var pending sync.WaitGroup
+	defer pending.Wait()
+
+	encoder := json.NewEncoder(conn)
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	for scanner.Scan() {
+		var request RPCRequest
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			return fmt.Errorf("invalid request : %v", err)
+		}
+		pending.Add(1)
+		go func() {
+			defer pending.Done()
+			response := handle(filter, request)
+			writeMutex.Lock()
+			defer writeMutex.Unlock()
+			_ = encoder.Encode(response)
+		}()
+	}
+	return scanner.Err()
+}
+
+func handle(filter Filter, request RPCRequest) (response RPCResponse) {
+	response = RPCResponse{JSONRPC: "2.0", ID: request.ID}
+	fail := func(code int, err error) RPCResponse {
+		response.Error = &RPCError{Code: code, Message: err.Error()}
+		return response
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			response = fail(CodeFilterError, fmt.Errorf("filter panicked : %v", r))
+		}
+	}()
+
+	var result interface{} = struct{}{}
+	switch request.Method {
+	case MethodConfig:
+		result = filter.Config()
+	case MethodConfigure:
+		var params ConfigureParams
+		if err := json.Unmarshal(request.Params, &params); err != nil {
+			return fail(CodeInvalidParams, err)
+		}
+		if configurable, ok := filter.(Configurable); ok {
+			if err := configurable.Configure(params.Settings); err != nil {
+				return fail(CodeFilterError, err)
+			}
+		}
+	case MethodExec:
+		var params Request
+		if err := json.Unmarshal(request.Params, &params); err != nil {
+			return fail(CodeInvalidParams, err)
+		}
+		execResult, err := filter.Exec(params)
+		if err != nil {
+			return fail(CodeFilterError, err)
+		}
+		result = execResult
+	default:
+		return fail(CodeMethodNotFound, fmt.Errorf("unknown method %s", request.Method))
+	}
+
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return fail(CodeFilterError, err)
+	}
+	response.Result = encoded
+	return response
+}
@@ -0,0 +1,157 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+// jwk a JSON Web Key, as read from the JWKS file
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	// symmetric
+	K string `json:"k"`
+}
+
+// key a parsed key : *rsa.PublicKey, *ecdsa.PublicKey or []byte
+type key struct {
+	kid string
+	alg string
+	key interface{}
+}
+
+type cachedSet struct {
+	modTime time.Time
+	size    int64
+	keys    []key
+}
+
+// ErrNoKeys returned for a JWKS file without a usable key
+var ErrNoKeys = errors.New("no RSA, EC P-256 or symmetric key found")
+
+var (
+	cacheMutex sync.Mutex
+	cache      = make(map[string]cachedSet)
+)
+
+// loadJWKS the keys of the JWKS file, parsed again only when the file changes
+func loadJWKS(file string) ([]key, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the JWKS file : %v", err)
+	}
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	if cached, ok := cache[file]; ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.keys, nil
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the JWKS file : %v", err)
+	}
+	keys, err := parseJWKS(content)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the JWKS file %s : %v", file, err)
+	}
+	cache[file] = cachedSet{modTime: info.ModTime(), size: info.Size(), keys: keys}
+	return keys, nil
+}
+
+// parseJWKS the signature verification keys of a JWKS, the encryption keys and the unsupported ones are left out
+func parseJWKS(content []byte) ([]key, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(content, &set); err != nil {
+		return nil, err
+	}
+	var keys []key
+	for i, raw := range set.Keys {
+		if raw.Use != "" && raw.Use != "sig" {
+			continue
+		}
+		parsed, err := raw.parse()
+		if err != nil {
+			return nil, fmt.Errorf("key %d (kid %q) : %v", i, raw.Kid, err)
+		}
+		if parsed != nil {
+			keys = append(keys, key{kid: raw.Kid, alg: raw.Alg, key: parsed})
+		}
+	}
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	return keys, nil
+}
+
+// parse the public key, or the secret of a symmetric key. nil for the unsupported key types
+func (k jwk) parse() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid n : %v", err)
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid e : %v", err)
+		}
+		if !e.IsInt64() || e.Int64() < 2 || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid e")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, nil
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x : %v", err)
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y : %v", err)
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, fmt.Errorf("the point is not on the P-256 curve")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil || len(secret) == 0 {
+			return nil, fmt.Errorf("invalid k")
+		}
+		return secret, nil
+	}
+	return nil, nil
+}
+
+func decodeInt(value string) (*big.Int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) == 0 {
+		return nil, fmt.Errorf("empty")
+	}
+	return new(big.Int).SetBytes(decoded), nil
+}
@@ -0,0 +1,233 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Algorithms supported by Verify
+const (
+	RS256 = "RS256"
+	ES256 = "ES256"
+	HS256 = "HS256"
+)
+
+// Options the key material and the claims checked by Verify
+type Options struct {
+	// JWKSFile file of the JSON Web Key Set holding the RSA, EC P-256 and symmetric keys
+	JWKSFile string
+	// Secret shared secret of the HS256 tokens, besides the symmetric keys of the JWKS file
+	Secret string
+	// Issuer expected iss claim, not checked if empty
+	Issuer string
+	// Audience expected in the aud claim, not checked if empty
+	Audience string
+	// Algorithms accepted algorithms, all the supported ones if empty
+	Algorithms []string
+	// Leeway clock skew accepted checking the exp and nbf claims
+	Leeway time.Duration
+}
+
+// ValidationError a token rejected by Verify
+type ValidationError struct {
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid token : " + e.Reason
+}
+
+func invalid(format string, args ...interface{}) error {
+	return &ValidationError{Reason: fmt.Sprintf(format, args...)}
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify checks the signature of a compact serialized JWT against the key material of the options, then its exp, nbf,
+// iss and aud claims, and returns its claims. The exp and nbf claims are only checked when present.
+// Tokens are rejected with a ValidationError, key material problems are returned as other errors
+func Verify(token string, options Options) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalid("expected 3 parts, got %d", len(parts))
+	}
+
+	var head header
+	if err := decodePart(parts[0], &head); err != nil {
+		return nil, invalid("malformed header : %v", err)
+	}
+	if !allowed(head.Alg, options.Algorithms) {
+		return nil, invalid("algorithm %q not accepted", head.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalid("malformed signature : %v", err)
+	}
+
+	keys, err := candidates(head, options)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, invalid("no %s key matching the kid %q", head.Alg, head.Kid)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	verified := false
+	for _, key := range keys {
+		if verify(head.Alg, key, parts[0]+"."+parts[1], digest[:], signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, invalid("signature verification failed")
+	}
+
+	claims := make(map[string]interface{})
+	if err := decodePart(parts[1], &claims); err != nil {
+		return nil, invalid("malformed claims : %v", err)
+	}
+	if err := checkClaims(claims, options, time.Now()); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func decodePart(part string, target interface{}) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(decoded, target)
+}
+
+func allowed(alg string, algorithms []string) bool {
+	if alg != RS256 && alg != ES256 && alg != HS256 {
+		return false
+	}
+	if len(algorithms) == 0 {
+		return true
+	}
+	for _, candidate := range algorithms {
+		if candidate == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// candidates the keys of the options able to verify the token : the key type must match the algorithm, and the kid
+// the one of the token when the token has one
+func candidates(head header, options Options) ([]interface{}, error) {
+	var keys []interface{}
+	if options.Secret != "" && head.Alg == HS256 {
+		keys = append(keys, []byte(options.Secret))
+	}
+	if options.JWKSFile == "" {
+		return keys, nil
+	}
+	set, err := loadJWKS(options.JWKSFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range set {
+		if head.Kid != "" && key.kid != head.Kid {
+			continue
+		}
+		if key.alg != "" && key.alg != head.Alg {
+			continue
+		}
+		switch key.key.(type) {
+		case *rsa.PublicKey:
+			if head.Alg == RS256 {
+				keys = append(keys, key.key)
+			}
+		case *ecdsa.PublicKey:
+			if head.Alg == ES256 {
+				keys = append(keys, key.key)
+			}
+		case []byte:
+			if head.Alg == HS256 {
+				keys = append(keys, key.key)
+			}
+		}
+	}
+	return keys, nil
+}
+
+func verify(alg string, key interface{}, signingInput string, digest, signature []byte) bool {
+	switch alg {
+	case RS256:
+		return rsa.VerifyPKCS1v15(key.(*rsa.PublicKey), crypto.SHA256, digest, signature) == nil
+	case ES256:
+		if len(signature) != 64 {
+			return false
+		}
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(key.(*ecdsa.PublicKey), digest, r, s)
+	case HS256:
+		mac := hmac.New(sha256.New, key.([]byte))
+		mac.Write([]byte(signingInput))
+		return hmac.Equal(mac.Sum(nil), signature)
+	}
+	return false
+}
+
+func checkClaims(claims map[string]interface{}, options Options, now time.Time) error {
+	if exp, ok := claims["exp"]; ok {
+		seconds, isNumber := exp.(float64)
+		if !isNumber {
+			return invalid("exp is not a number")
+		}
+		if !now.Before(unixTime(seconds).Add(options.Leeway)) {
+			return invalid("expired at %s", unixTime(seconds).UTC().Format(time.RFC3339))
+		}
+	}
+	if nbf, ok := claims["nbf"]; ok {
+		seconds, isNumber := nbf.(float64)
+		if !isNumber {
+			return invalid("nbf is not a number")
+		}
+		if now.Add(options.Leeway).Before(unixTime(seconds)) {
+			return invalid("not valid before %s", unixTime(seconds).UTC().Format(time.RFC3339))
+		}
+	}
+	if options.Issuer != "" && claims["iss"] != options.Issuer {
+		return invalid("issuer %v, expected %s", claims["iss"], options.Issuer)
+	}
+	if options.Audience != "" && !hasAudience(claims["aud"], options.Audience) {
+		return invalid("audience %v, expected %s", claims["aud"], options.Audience)
+	}
+	return nil
+}
+
+func unixTime(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+// hasAudience the aud claim is the audience, or an array holding it
+func hasAudience(aud interface{}, audience string) bool {
+	switch value := aud.(type) {
+	case string:
+		return value == audience
+	case []interface{}:
+		for _, item := range value {
+			if item == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func encodePart(t *testing.T, value interface{}) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func sign(t *testing.T, head map[string]string, claims map[string]interface{}, key interface{}) string {
+	input := encodePart(t, head) + "." + encodePart(t, claims)
+	digest := sha256.Sum256([]byte(input))
+	var signature []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(input))
+		signature = mac.Sum(nil)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func encodeInt(value *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(value.Bytes())
+}
+
+func TestVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("a shared secret of the registry")
+
+	dir, err := ioutil.TempDir("", "jwt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	jwks := map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": encodeInt(rsaKey.N), "e": encodeInt(big.NewInt(int64(rsaKey.E)))},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": encodeInt(ecKey.X), "y": encodeInt(ecKey.Y)},
+		{"kty": "oct", "kid": "hmac", "k": base64.RawURLEncoding.EncodeToString(secret)},
+	}}
+	encoded, _ := json.Marshal(jwks)
+	jwksFile := filepath.Join(dir, "jwks.json")
+	if err := ioutil.WriteFile(jwksFile, encoded, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Unix()
+	claims := map[string]interface{}{"sub": "ana", "iss": "https://auth.local", "aud": []string{"go-horse"}, "exp": now + 60}
+	options := Options{JWKSFile: jwksFile, Issuer: "https://auth.local", Audience: "go-horse"}
+
+	valid := map[string]string{
+		"RS256": sign(t, map[string]string{"alg": "RS256", "kid": "rsa"}, claims, rsaKey),
+		"ES256": sign(t, map[string]string{"alg": "ES256"}, claims, ecKey),
+		"HS256": sign(t, map[string]string{"alg": "HS256", "kid": "hmac"}, claims, secret),
+	}
+	for alg, token := range valid {
+		verified, err := Verify(token, options)
+		if err != nil || verified["sub"] != "ana" {
+			t.Errorf("expected the %s token to be valid, got %v, %v", alg, verified, err)
+		}
+	}
+	if _, err := Verify(valid["HS256"], Options{Secret: string(secret)}); err != nil {
+		t.Errorf("expected the HS256 token to be valid with the secret, got %v", err)
+	}
+
+	expired := map[string]interface{}{"sub": "ana", "exp": now - 120}
+	tamperedClaims := encodePart(t, map[string]interface{}{"sub": "admin", "iss": "https://auth.local", "aud": "go-horse", "exp": now + 60})
+	tampered := strings.Split(valid["RS256"], ".")
+	invalidTokens := map[string]string{
+		"expired":        sign(t, map[string]string{"alg": "RS256", "kid": "rsa"}, expired, rsaKey),
+		"wrong audience": sign(t, map[string]string{"alg": "ES256"}, map[string]interface{}{"iss": "https://auth.local", "aud": "other"}, ecKey),
+		"unknown kid":    sign(t, map[string]string{"alg": "RS256", "kid": "old"}, claims, rsaKey),
+		"tampered":       tampered[0] + "." + tamperedClaims + "." + tampered[2],
+		"alg none":       encodePart(t, map[string]string{"alg": "none"}) + "." + encodePart(t, claims) + ".",
+		// HS256 signed with the RSA public key, a key confusion attack
+		"key confusion": sign(t, map[string]string{"alg": "HS256", "kid": "rsa"}, claims, rsaKey.N.Bytes()),
+	}
+	for name, token := range invalidTokens {
+		if _, err := Verify(token, options); err == nil {
+			t.Errorf("expected the %s token to be rejected", name)
+		} else if _, ok := err.(*ValidationError); !ok {
+			t.Errorf("expected a ValidationError for the %s token, got %v", name, err)
+		}
+	}
+
+	if _, err := Verify(valid["ES256"], Options{JWKSFile: jwksFile, Algorithms: []string{"RS256"}}); err == nil {
+		t.Errorf("expected the ES256 token to be rejected when only RS256 is accepted")
+	}
+	if _, err := Verify(valid["ES256"], Options{JWKSFile: filepath.Join(dir, "missing.json")}); err == nil {
+		t.Errorf("expected an error for a missing JWKS file")
+	}
+}
@@ -6,8 +6,8 @@ import (
 	filter "github.com/labbsr0x/go-horse/filters/config-filter"
 	"github.com/labbsr0x/go-horse/filters/filtergo"
 	"github.com/labbsr0x/go-horse/filters/filterjs"
+	"github.com/labbsr0x/go-horse/filters/filterproc"
 
-	"sort"
 	"sync"
 	"time"
 
@@ -17,23 +17,34 @@ import (
 	"github.com/radovskyb/watcher"
 )
 
-// All requests and response filters
-var all []model.Filter
-
-// Request requests filters
-var request []model.Filter
-
-// Response response filters
-var response []model.Filter
+// chain the filters and the errors of a filters load, replaced as a whole by the next load
+type chain struct {
+	// all requests and response filters
+	all      []model.Filter
+	request  []model.Filter
+	response []model.Filter
+	// loadErrors errors found on the filters load
+	loadErrors []model.LoadError
+}
 
-var updateLock = sync.WaitGroup{}
-var isUpdating = false
+var (
+	// current the chain of the last filters load, read by the requests while the next one is built
+	current      chain
+	currentMutex sync.RWMutex
+	// loadMutex serializes the filters loads
+	loadMutex sync.Mutex
+	// reloads the pending reload of the filters, the reloads requested meanwhile are merged into it
+	reloads = make(chan struct{}, 1)
+	// reloadOnce starts the goroutine running the reloads
+	reloadOnce sync.Once
+)
 
 type ListAPI interface {
 	Load()
 	createDirWatcher() *watcher.Watcher
 	RequestFilters() []model.Filter
 	ResponseFilters() []model.Filter
+	LoadErrors() []model.LoadError
 	Init()
 	Reload()
 }
@@ -49,26 +60,38 @@ func (dapi *DefaultListAPI) InitFromFilterBuilder(filterBuilder *filter.FilterBu
 
 // RequestFilters lero lero
 func (dapi *DefaultListAPI) RequestFilters() []model.Filter {
-	if isUpdating {
-		updateLock.Wait()
-	}
-	return request
+	currentMutex.RLock()
+	defer currentMutex.RUnlock()
+	return current.request
 }
 
 // ResponseFilters lero lero
 func (dapi *DefaultListAPI) ResponseFilters() []model.Filter {
-	if isUpdating {
-		updateLock.Wait()
-	}
-	return response
+	currentMutex.RLock()
+	defer currentMutex.RUnlock()
+	return current.response
 }
 
+// LoadErrors errors found on the last filters load
+func (dapi *DefaultListAPI) LoadErrors() []model.LoadError {
+	currentMutex.RLock()
+	defer currentMutex.RUnlock()
+	return current.loadErrors
+}
+
+// updateFilters requests a reload of the filters. The directories watcher and the filter processes starting late
+// request them, they are run one at a time by a single goroutine
 func (dapi *DefaultListAPI) updateFilters() {
-	updateLock.Add(1)
-	isUpdating = true
-	dapi.Load()
-	updateLock.Done()
-	isUpdating = false
+	select {
+	case reloads <- struct{}{}:
+	default:
+	}
+}
+
+func (dapi *DefaultListAPI) runReloads() {
+	for range reloads {
+		dapi.Load()
+	}
 }
 
 func (dapi *DefaultListAPI) Init() {
@@ -77,22 +100,67 @@ func (dapi *DefaultListAPI) Init() {
 
 // Reload Reload
 func (dapi *DefaultListAPI) Reload() {
+	reloadOnce.Do(func() { go dapi.runReloads() })
 	dapi.createDirWatcher()
+	filterproc.OnLateStart(dapi.updateFilters)
 	dapi.Load()
 }
 
-// Load Load
+// Load builds the filter chain and replaces the current one once it is complete. The requests keep the previous chain
+// meanwhile
 func (dapi *DefaultListAPI) Load() {
-
-	all = all[:0]
-	request = request[:0]
-	response = response[:0]
-
-	jsFilters := filterjs.Load(dapi.FlagsFilter.JsFiltersPath)
-	goFilters := plugins.Load(dapi.FlagsFilter.GoPluginsPath)
+	loadMutex.Lock()
+	defer loadMutex.Unlock()
+
+	var all, request, response []model.Filter
+
+	library := filterjs.LoadLibrary(dapi.FlagsFilter.JsFiltersPath)
+	jsFilters, filterErrors := filterjs.Load(dapi.FlagsFilter.JsFiltersPath, library)
+	httpOptions := filterjs.HTTPOptions{
+		Timeout:      time.Duration(dapi.FlagsFilter.JsHTTPTimeout) * time.Millisecond,
+		AllowedHosts: dapi.FlagsFilter.JsHTTPAllowedHosts,
+		CertFile:     dapi.FlagsFilter.JsHTTPCert,
+		KeyFile:      dapi.FlagsFilter.JsHTTPKey,
+		CAFile:       dapi.FlagsFilter.JsHTTPCA,
+		Retries:      dapi.FlagsFilter.JsHTTPRetries,
+	}
+	httpClient, err := filterjs.NewHTTPClient(httpOptions)
+	if err != nil {
+		// the filters still get a client, without the TLS settings, the calls needing them will fail
+		filterErrors = append(filterErrors, model.LoadError{Error: err.Error()})
+		httpOptions.CertFile, httpOptions.KeyFile, httpOptions.CAFile = "", "", ""
+		httpClient, _ = filterjs.NewHTTPClient(httpOptions)
+	}
+	jsOptions := filterjs.Options{
+		Engine:         dapi.FlagsFilter.JsEngine,
+		PoolSize:       dapi.FlagsFilter.JsVMPoolSize,
+		CPUBudget:      time.Duration(dapi.FlagsFilter.JsCPUBudget) * time.Millisecond,
+		MaxResultSize:  dapi.FlagsFilter.JsMaxResultSize,
+		DeniedGlobals:  dapi.FlagsFilter.JsDeniedGlobals,
+		Library:        library,
+		HTTP:           httpClient,
+		CaptureConsole: dapi.FlagsFilter.JsCaptureConsole,
+	}
+	for _, name := range jsOptions.DeniedGlobals {
+		if filterjs.ProtectedGlobals[name] {
+			logrus.WithFields(logrus.Fields{
+				"global": name,
+			}).Warnf("JS global can't be denied, ignored")
+		}
+	}
+	goFilters, pluginErrors := plugins.Load(dapi.FlagsFilter.GoPluginsPath)
+	filterErrors = append(filterErrors, pluginErrors...)
 
 	for _, jsFilter := range jsFilters {
-		filter := filterjs.NewFilterJS(jsFilter)
+		filter, err := filterjs.NewFilterJS(jsFilter, jsOptions)
+		if err != nil {
+			filterErrors = append(filterErrors, model.LoadError{
+				File:   jsFilter.File,
+				Filter: jsFilter.Name,
+				Error:  err.Error(),
+			})
+			continue
+		}
 		all = append(all, filter)
 		if filter.Config().Invoke == model.Request {
 			request = append(request, filter)
@@ -101,8 +169,9 @@ func (dapi *DefaultListAPI) Load() {
 		}
 	}
 
-	for _, goFilter := range goFilters {
-		filter := filtergo.NewFilterGO(goFilter)
+	procFilters, procErrors := filterproc.Load(dapi.FlagsFilter.ProcessFiltersPath)
+	filterErrors = append(filterErrors, procErrors...)
+	for _, filter := range procFilters {
 		all = append(all, filter)
 		if filter.Config().Invoke == model.Request {
 			request = append(request, filter)
@@ -111,29 +180,42 @@ func (dapi *DefaultListAPI) Load() {
 		}
 	}
 
-	dapi.validateFilterOrder(request)
-	dapi.validateFilterOrder(response)
-	dapi.orderFilterModels(all, request, response)
-}
-
-func (dapi *DefaultListAPI) orderFilterModels(models ...[]model.Filter) {
-	for _, filters := range models {
-		sort.SliceStable(filters[:], func(i, j int) bool {
-			return filters[i].Config().Order < filters[j].Config().Order
-		})
+	for _, goFilter := range goFilters {
+		filter, err := filtergo.NewFilterGO(goFilter.GoFilterDefinition)
+		if err == nil {
+			err = filter.Configure(goFilter.File)
+		}
+		if err != nil {
+			filterErrors = append(filterErrors, model.LoadError{
+				File:   goFilter.File,
+				Filter: filter.Name,
+				Error:  err.Error(),
+			})
+			continue
+		}
+		all = append(all, filter)
+		if filter.Config().Invoke == model.Request {
+			request = append(request, filter)
+		} else {
+			response = append(response, filter)
+		}
 	}
-}
 
-func (dapi *DefaultListAPI) validateFilterOrder(models []model.Filter) {
-	last := -1
-	for _, filter := range models {
-		if filter.Config().Order == last {
-			logrus.WithFields(logrus.Fields{
-				"2 or more filters with the same order value": last,
-			}).Fatalf("Error on filters definitions : property configuration mismatch ORDER")
-			panic("Fix the filters configurations, including the plugins")
-		}
-		last = filter.Config().Order
+	var requestErrors, responseErrors []model.LoadError
+	request, requestErrors = sortFilters(request)
+	response, responseErrors = sortFilters(response)
+	all = append(append(all[:0], request...), response...)
+
+	loadErrors := append(append(filterErrors, requestErrors...), responseErrors...)
+	currentMutex.Lock()
+	current = chain{all: all, request: request, response: response, loadErrors: loadErrors}
+	currentMutex.Unlock()
+	for _, loadError := range loadErrors {
+		logrus.WithFields(logrus.Fields{
+			"file":   loadError.File,
+			"filter": loadError.Filter,
+			"error":  loadError.Error,
+		}).Errorf("Error on filters definitions")
 	}
 }
 
@@ -145,10 +227,10 @@ func (dapi *DefaultListAPI) createDirWatcher() *watcher.Watcher {
 		for {
 			select {
 			case event := <-dirWatcher.Event:
-				dapi.updateFilters()
 				logrus.WithFields(logrus.Fields{
 					"event": event,
 				}).Warnf("Filters definition updated")
+				dapi.updateFilters()
 			case err := <-dirWatcher.Error:
 				logrus.WithFields(logrus.Fields{
 					"error": err.Error(),
@@ -165,6 +247,21 @@ func (dapi *DefaultListAPI) createDirWatcher() *watcher.Watcher {
 		}).Errorf("DirWatcher error")
 	}
 
+	// new plugin versions are deployed under new file names, the plugins directory itself is enough
+	if err := dirWatcher.Add(dapi.FlagsFilter.GoPluginsPath); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Errorf("DirWatcher error")
+	}
+
+	if dapi.FlagsFilter.ProcessFiltersPath != "" {
+		if err := dirWatcher.Add(dapi.FlagsFilter.ProcessFiltersPath); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err.Error(),
+			}).Errorf("DirWatcher error")
+		}
+	}
+
 
 	go func() {
 		if err := dirWatcher.Start(time.Second); err != nil {
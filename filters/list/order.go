@@ -0,0 +1,132 @@
+package list
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/labbsr0x/go-horse/filters/model"
+)
+
+// sortFilters orders a filter chain by phase, then by the before/after relationships, then by order and name.
+// Filters with an unknown phase or a duplicated name are left out of the chain, relationships breaking the phases
+// order are ignored and cycles are broken by the order and name of the filters. All of them are reported as load errors
+func sortFilters(filters []model.Filter) ([]model.Filter, []model.LoadError) {
+	var loadErrors []model.LoadError
+
+	candidates := make([]model.Filter, 0, len(filters))
+	for _, filter := range filters {
+		if model.PhaseRank(filter.Config().Phase) < 0 {
+			loadErrors = append(loadErrors, model.LoadError{
+				Filter: filter.Config().Name,
+				Error:  fmt.Sprintf("unknown phase %q, expected one of %s", filter.Config().Phase, strings.Join(model.Phases, ", ")),
+			})
+			continue
+		}
+		candidates = append(candidates, filter)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return lessFilter(candidates[i].Config(), candidates[j].Config())
+	})
+
+	nodes := make(map[string]int)
+	var chain []model.Filter
+	for _, filter := range candidates {
+		config := filter.Config()
+		if _, duplicated := nodes[config.Name]; duplicated {
+			loadErrors = append(loadErrors, model.LoadError{
+				Filter: config.Name,
+				Error:  fmt.Sprintf("duplicated %s filter name, only the one with the lowest order is loaded", config.InvokeName()),
+			})
+			continue
+		}
+		nodes[config.Name] = len(chain)
+		chain = append(chain, filter)
+	}
+
+	successors := make([][]int, len(chain))
+	predecessors := make([]int, len(chain))
+	addEdge := func(from, to int) {
+		fromConfig, toConfig := chain[from].Config(), chain[to].Config()
+		if model.PhaseRank(fromConfig.Phase) > model.PhaseRank(toConfig.Phase) {
+			loadErrors = append(loadErrors, model.LoadError{
+				Filter: fromConfig.Name,
+				Error:  fmt.Sprintf("can't run before %s, its phase comes first : relationship ignored", toConfig.Name),
+			})
+			return
+		}
+		successors[from] = append(successors[from], to)
+		predecessors[to]++
+	}
+	for index, filter := range chain {
+		config := filter.Config()
+		for _, name := range config.Before {
+			if other, ok := nodes[name]; ok && other != index {
+				addEdge(index, other)
+			}
+		}
+		for _, name := range config.After {
+			if other, ok := nodes[name]; ok && other != index {
+				addEdge(other, index)
+			}
+		}
+	}
+
+	// Kahn's algorithm, always picking the lowest ready filter of the current phase to keep the chain deterministic.
+	// chain is already sorted, so the lowest filter is the one with the lowest index
+	sorted := make([]model.Filter, 0, len(chain))
+	done := make([]bool, len(chain))
+	for len(sorted) < len(chain) {
+		next := -1
+		phase := -1
+		for index := range chain {
+			if done[index] {
+				continue
+			}
+			rank := model.PhaseRank(chain[index].Config().Phase)
+			if phase < 0 {
+				phase = rank
+			} else if rank > phase {
+				break
+			}
+			if predecessors[index] == 0 {
+				next = index
+				break
+			}
+		}
+		if next < 0 {
+			var cycle []string
+			for index := range chain {
+				if !done[index] && model.PhaseRank(chain[index].Config().Phase) == phase {
+					cycle = append(cycle, chain[index].Config().Name)
+				}
+			}
+			loadErrors = append(loadErrors, model.LoadError{
+				Error: fmt.Sprintf("before/after cycle among the filters %s : ordered by phase, order and name", strings.Join(cycle, ", ")),
+			})
+			for index := range chain {
+				if !done[index] {
+					next = index
+					break
+				}
+			}
+		}
+		done[next] = true
+		sorted = append(sorted, chain[next])
+		for _, successor := range successors[next] {
+			predecessors[successor]--
+		}
+	}
+
+	return sorted, loadErrors
+}
+
+func lessFilter(a, b model.FilterConfig) bool {
+	if rankA, rankB := model.PhaseRank(a.Phase), model.PhaseRank(b.Phase); rankA != rankB {
+		return rankA < rankB
+	}
+	if a.Order != b.Order {
+		return a.Order < b.Order
+	}
+	return a.Name < b.Name
+}
@@ -0,0 +1,92 @@
+package list
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kataras/iris"
+	"github.com/labbsr0x/go-horse/filters/model"
+)
+
+type fakeFilter struct {
+	model.FilterConfig
+}
+
+func (f fakeFilter) Config() model.FilterConfig {
+	return f.FilterConfig
+}
+
+func (f fakeFilter) Exec(ctx iris.Context, requestBody string) (model.FilterReturn, error) {
+	return model.FilterReturn{Next: true}, nil
+}
+
+func (f fakeFilter) MatchURL(ctx iris.Context) bool {
+	return true
+}
+
+func names(filters []model.Filter) []string {
+	var result []string
+	for _, filter := range filters {
+		result = append(result, filter.Config().Name)
+	}
+	return result
+}
+
+func TestSortFiltersByPhaseAndRelationships(t *testing.T) {
+	filters := []model.Filter{
+		fakeFilter{model.FilterConfig{Name: "audit", Phase: "audit"}},
+		fakeFilter{model.FilterConfig{Name: "labels", Order: 1}},
+		fakeFilter{model.FilterConfig{Name: "names", Order: 1, Before: []string{"labels"}}},
+		fakeFilter{model.FilterConfig{Name: "acl", Phase: "authorize", After: []string{"token"}}},
+		fakeFilter{model.FilterConfig{Name: "token", Phase: "authorize", Order: 5}},
+		fakeFilter{model.FilterConfig{Name: "identity", Phase: "authenticate", Order: 9}},
+		fakeFilter{model.FilterConfig{Name: "quota", Order: 1}},
+	}
+
+	sorted, loadErrors := sortFilters(filters)
+
+	expected := []string{"identity", "token", "acl", "names", "labels", "quota", "audit"}
+	if !reflect.DeepEqual(names(sorted), expected) {
+		t.Errorf("expected %v, got %v", expected, names(sorted))
+	}
+	if len(loadErrors) != 0 {
+		t.Errorf("unexpected load errors %v", loadErrors)
+	}
+}
+
+func TestSortFiltersIsDeterministic(t *testing.T) {
+	a := fakeFilter{model.FilterConfig{Name: "a", Order: 1}}
+	b := fakeFilter{model.FilterConfig{Name: "b", Order: 1}}
+	c := fakeFilter{model.FilterConfig{Name: "c", Order: 0}}
+
+	first, _ := sortFilters([]model.Filter{a, b, c})
+	second, _ := sortFilters([]model.Filter{b, c, a})
+
+	if !reflect.DeepEqual(names(first), []string{"c", "a", "b"}) || !reflect.DeepEqual(names(first), names(second)) {
+		t.Errorf("expected the same chain c, a, b, got %v and %v", names(first), names(second))
+	}
+}
+
+func TestSortFiltersReportsErrors(t *testing.T) {
+	filters := []model.Filter{
+		fakeFilter{model.FilterConfig{Name: "dup", Order: 2}},
+		fakeFilter{model.FilterConfig{Name: "dup", Order: 1}},
+		fakeFilter{model.FilterConfig{Name: "unknown", Phase: "whatever"}},
+		fakeFilter{model.FilterConfig{Name: "x", Order: 3, After: []string{"y"}}},
+		fakeFilter{model.FilterConfig{Name: "y", Order: 4, After: []string{"x"}}},
+		fakeFilter{model.FilterConfig{Name: "late", Phase: "audit", Before: []string{"x"}}},
+	}
+
+	sorted, loadErrors := sortFilters(filters)
+
+	expected := []string{"dup", "x", "y", "late"}
+	if !reflect.DeepEqual(names(sorted), expected) {
+		t.Errorf("expected %v, got %v", expected, names(sorted))
+	}
+	if sorted[0].Config().Order != 1 {
+		t.Errorf("expected the duplicated filter with the lowest order to be kept")
+	}
+	if len(loadErrors) != 4 {
+		t.Errorf("expected 4 load errors (unknown phase, duplicate, phase relationship, cycle), got %v", loadErrors)
+	}
+}
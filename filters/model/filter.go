@@ -1,9 +1,14 @@
 package model
 
 import (
+	"fmt"
+	"net/http"
+	"path/filepath"
 	"regexp"
+	"time"
 
 	"github.com/kataras/iris"
+	"github.com/labbsr0x/go-horse/util"
 )
 
 // BodyOperation : Read or Write > If the body content was updated by the filter and needs to be overwritten in the response,  Write property should be passed
@@ -16,6 +21,14 @@ const (
 	Write BodyOperation = 1
 )
 
+// String READ or WRITE, as named in the JS filters
+func (o BodyOperation) String() string {
+	if o == Write {
+		return "WRITE"
+	}
+	return "READ"
+}
+
 // Invoke : a property to tell if the filter is gonna be executed before (Request) or after (Response) the client request be send to the docker daemon
 type Invoke int
 
@@ -26,6 +39,154 @@ const (
 	Request Invoke = 1
 )
 
+// ParseInvoke parses the `request` or `response` invoke names
+func ParseInvoke(name string) (Invoke, error) {
+	switch name {
+	case "request":
+		return Request, nil
+	case "response":
+		return Response, nil
+	}
+	return Response, fmt.Errorf("unknown invoke %q, expected request or response", name)
+}
+
+// FailurePolicy : what the filter chain does when a filter times out or panics
+type FailurePolicy int
+
+const (
+	// Deny stops the filter chain and answers the client with the filter failure status and message
+	Deny FailurePolicy = 0
+	// Skip ignores the failing filter and continues the filter chain
+	Skip FailurePolicy = 1
+)
+
+// ParseFailurePolicy parses the `deny` or `skip` failure policy names
+func ParseFailurePolicy(name string) (FailurePolicy, error) {
+	switch name {
+	case "deny", "":
+		return Deny, nil
+	case "skip":
+		return Skip, nil
+	}
+	return Deny, fmt.Errorf("unknown failure policy %q, expected deny or skip", name)
+}
+
+// CheckStatus checks the status is an HTTP status, from 100 to 599
+func CheckStatus(status int) error {
+	if status < 100 || status > 599 {
+		return fmt.Errorf("%d is not an HTTP status, expected 100 to 599", status)
+	}
+	return nil
+}
+
+// CheckFailurePolicy checks the timeout is not negative and the failure status, when set, is an HTTP status
+func (config FilterConfig) CheckFailurePolicy() error {
+	if config.Timeout < 0 {
+		return fmt.Errorf("invalid timeout : %v is negative", config.Timeout)
+	}
+	if config.FailureStatus != 0 {
+		if err := CheckStatus(config.FailureStatus); err != nil {
+			return fmt.Errorf("invalid failureStatus : %v", err)
+		}
+	}
+	return nil
+}
+
+// Mode : enforce or shadow. A shadow filter is executed but its result is discarded, as if it had returned next true and READ
+type Mode int
+
+const (
+	// Enforce the filter result is applied to the filter chain
+	Enforce Mode = 0
+	// Shadow the filter result is only logged and counted
+	Shadow Mode = 1
+)
+
+// ParseMode parses the `enforce` or `shadow` mode names
+func ParseMode(name string) (Mode, error) {
+	switch name {
+	case "enforce", "":
+		return Enforce, nil
+	case "shadow":
+		return Shadow, nil
+	}
+	return Enforce, fmt.Errorf("unknown filter mode %q, expected enforce or shadow", name)
+}
+
+// DefaultPhase phase of the filters that don't declare one
+const DefaultPhase = "default"
+
+// Phases named filter phases, in execution order
+var Phases = []string{"authenticate", "authorize", "validate", "mutate", DefaultPhase, "audit"}
+
+// PhaseRank position of the phase in the execution order, -1 if unknown
+func PhaseRank(phase string) int {
+	if phase == "" {
+		phase = DefaultPhase
+	}
+	for rank, name := range Phases {
+		if name == phase {
+			return rank
+		}
+	}
+	return -1
+}
+
+// LoadError an error found while loading the filters. The process goes on, without the filter when it can't be used
+type LoadError struct {
+	File   string `json:"file,omitempty"`
+	Filter string `json:"filter,omitempty"`
+	Error  string `json:"error"`
+}
+
+// LimitError a filter stopped for exceeding one of its sandbox limits. It is handled like a timeout or a panic,
+// according to the filter failure policy
+type LimitError struct {
+	Filter string
+	Limit  string
+	Detail string
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("filter %s exceeded its %s limit : %s", e.Filter, e.Limit, e.Detail)
+}
+
+// UnavailableError a process filter that is not running or doesn't answer. It is handled like a timeout or a panic,
+// according to the filter failure policy
+type UnavailableError struct {
+	Filter string
+	Detail string
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("filter %s is unavailable : %s", e.Filter, e.Detail)
+}
+
+// ScriptError an error thrown by a JS filter, located in the filter file
+type ScriptError struct {
+	Filter string
+	File   string
+	// Line and Column position in the file of the innermost frame of the filter, zero if unknown
+	Line   int
+	Column int
+	// Name JS error name, like TypeError, empty for the thrown values that are not errors
+	Name    string
+	Message string
+	// Stack the call frames, innermost first, like "inner (/app/go-horse/filters/acl.js:3:29)"
+	Stack []string
+}
+
+func (e *ScriptError) Error() string {
+	message := e.Message
+	if e.Name != "" {
+		message = e.Name + ": " + message
+	}
+	if e.Line > 0 {
+		return fmt.Sprintf("filter %s : %s (%s:%d:%d)", e.Filter, message, filepath.Base(e.File), e.Line, e.Column)
+	}
+	return fmt.Sprintf("filter %s : %s", e.Filter, message)
+}
+
 // Filter common filter interface between go and javascript filters
 type Filter interface {
 	Config() FilterConfig
@@ -33,6 +194,12 @@ type Filter interface {
 	MatchURL(ctx iris.Context) bool
 }
 
+// Cancelable optional interface of the filters whose execution can be stopped, like on a timeout. ExecCancelable
+// must return soon after cancel is closed, and must not use ctx once it returned. Go plugins may implement it
+type Cancelable interface {
+	ExecCancelable(ctx iris.Context, requestBody string, cancel <-chan struct{}) (FilterReturn, error)
+}
+
 // FilterConfig common filter configuration
 type FilterConfig struct {
 	Name        string
@@ -41,6 +208,43 @@ type FilterConfig struct {
 	Invoke      Invoke
 	Function    string
 	Regex       *regexp.Regexp
+	// Operations Docker Engine API operation IDs the filter applies to, like ContainerCreate. Can be used instead of PathPattern
+	Operations []string
+	// Methods HTTP methods the filter applies to, any method if empty
+	Methods []string
+	// Headers request headers the filter applies to : header name => value regex, an empty regex only checks the header presence
+	Headers      map[string]string
+	HeadersRegex map[string]*regexp.Regexp
+	// Query query parameters the filter applies to : parameter name => value regex, an empty regex only checks the parameter presence
+	Query      map[string]string
+	QueryRegex map[string]*regexp.Regexp
+	// Timeout maximum execution time of the filter, no deadline if zero
+	Timeout time.Duration
+	// Engine JS filters only : otto (ES5) or goja (ES2015+), the default engine if empty
+	Engine string
+	// CPUBudget JS filters only : time the filter can spend running JS before its VM is interrupted, the default budget if zero
+	CPUBudget time.Duration
+	// OnFailure what the filter chain does when the filter times out or panics
+	OnFailure FailurePolicy
+	// FailureStatus and FailureMessage are sent to the client when a failing filter denies the request
+	FailureStatus  int
+	FailureMessage string
+	// Mode enforce or shadow (dry-run)
+	Mode Mode
+	// Phase named phase of the filter, see Phases. Filters are sorted by phase, then by the Before and After relationships, then by Order and Name
+	Phase string
+	// Before names of the filters this filter must run before
+	Before []string
+	// After names of the filters this filter must run after
+	After []string
+	// File the file the filter was loaded from
+	File string
+	// FunctionLine and FunctionColumn JS filters only : position of the filter function in File, to locate its errors
+	FunctionLine   int
+	FunctionColumn int
+	// Settings the filter own configuration, read from its sidecar settings file. Never serialized, it holds the
+	// filter secrets
+	Settings map[string]interface{} `json:"-"`
 }
 
 // FilterReturn common filter return
@@ -49,9 +253,54 @@ type FilterReturn struct {
 	Body      string
 	Status    int
 	Operation BodyOperation
+	Headers   HeaderOperations
+	Response  *SyntheticResponse
 	Err       error
 }
 
+// SyntheticResponseKey request scope key of the response returned by a request filter
+const SyntheticResponseKey = "syntheticResponse"
+
+func init() {
+	util.ProtectRequestScopeKeys(SyntheticResponseKey, RequestHeadersKey, ResponseHeadersKey)
+}
+
+// SyntheticResponse a complete response returned by a request filter. It is served to the client as is,
+// the request is not sent to the daemon and the response filters are not executed
+type SyntheticResponse struct {
+	Status      int
+	Headers     map[string]string
+	ContentType string
+	Body        string
+}
+
+// CheckStatus defaults the status of the response to 200 and checks it is an HTTP status
+func (response *SyntheticResponse) CheckStatus() error {
+	if response.Status == 0 {
+		response.Status = http.StatusOK
+	}
+	if err := CheckStatus(response.Status); err != nil {
+		return fmt.Errorf("invalid response status : %v", err)
+	}
+	return nil
+}
+
+// FailurePolicyName the failure policy name, as used in the filters definitions
+func (fc *FilterConfig) FailurePolicyName() string {
+	if fc.OnFailure == Skip {
+		return "skip"
+	}
+	return "deny"
+}
+
+// ModeName the filter mode name, as used in the filters definitions
+func (fc *FilterConfig) ModeName() string {
+	if fc.Mode == Shadow {
+		return "shadow"
+	}
+	return "enforce"
+}
+
 func (fc *FilterConfig) InvokeName() string {
 	if fc.Invoke == Request {
 		return "REQUEST"
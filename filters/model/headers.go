@@ -0,0 +1,68 @@
+package model
+
+import (
+	"net/http"
+)
+
+const (
+	// RequestHeadersKey request scope key of the header operations applied to the request sent to the daemon
+	RequestHeadersKey = "requestHeaderOperations"
+	// ResponseHeadersKey request scope key of the header operations applied to the response sent to the client
+	ResponseHeadersKey = "responseHeaderOperations"
+)
+
+// HeaderOperations headers set or removed by a filter. Request filters change the request sent to the daemon,
+// response filters change the response sent to the client
+type HeaderOperations struct {
+	Set    map[string]string
+	Remove []string
+}
+
+// IsEmpty tells if there is nothing to change
+func (h HeaderOperations) IsEmpty() bool {
+	return len(h.Set) == 0 && len(h.Remove) == 0
+}
+
+// Merge adds the operations of a later filter, which take precedence over the current ones
+func (h HeaderOperations) Merge(later HeaderOperations) HeaderOperations {
+	merged := HeaderOperations{Set: make(map[string]string)}
+	for key, value := range h.Set {
+		merged.Set[http.CanonicalHeaderKey(key)] = value
+	}
+	removed := make(map[string]bool)
+	for _, key := range h.Remove {
+		removed[http.CanonicalHeaderKey(key)] = true
+	}
+	for _, key := range later.Remove {
+		key = http.CanonicalHeaderKey(key)
+		delete(merged.Set, key)
+		removed[key] = true
+	}
+	for key, value := range later.Set {
+		key = http.CanonicalHeaderKey(key)
+		delete(removed, key)
+		merged.Set[key] = value
+	}
+	for key := range removed {
+		merged.Remove = append(merged.Remove, key)
+	}
+	return merged
+}
+
+// Apply removes and then sets the headers
+func (h HeaderOperations) Apply(header http.Header) {
+	for _, key := range h.Remove {
+		header.Del(key)
+	}
+	for key, value := range h.Set {
+		header.Set(key, value)
+	}
+}
+
+// HeadersKey the request scope key of the header operations of the given invoke time
+func HeadersKey(invoke Invoke) string {
+	if invoke == Request {
+		return RequestHeadersKey
+	}
+	return ResponseHeadersKey
+}
@@ -0,0 +1,116 @@
+package model
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/labbsr0x/go-horse/dockerapi"
+)
+
+// CompileMatchers checks the operations and compiles the header and query value patterns of the filter configuration
+func (fc *FilterConfig) CompileMatchers() error {
+	for _, id := range fc.Operations {
+		if !dockerapi.Known(id) {
+			return fmt.Errorf("invalid operations : unknown Docker operation %q", id)
+		}
+	}
+	var err error
+	if fc.HeadersRegex, err = compileValuePatterns(fc.Headers); err != nil {
+		return err
+	}
+	fc.QueryRegex, err = compileValuePatterns(fc.Query)
+	return err
+}
+
+// MatchRequest tells if the request method, headers and query parameters satisfy the filter matchers.
+// Empty matchers match any request
+func (fc FilterConfig) MatchRequest(request *http.Request) bool {
+	if len(fc.Methods) > 0 && !matchMethod(fc.Methods, request.Method) {
+		return false
+	}
+	if !matchValues(fc.Headers, fc.HeadersRegex, request.Header) {
+		return false
+	}
+	if len(fc.Query) > 0 && !matchValues(fc.Query, fc.QueryRegex, request.URL.Query()) {
+		return false
+	}
+	return true
+}
+
+// MatchOperation tells if the Docker operation of the request is one of the filter operations.
+// Filters without operations match any request, even the ones not resolved to an operation
+func (fc FilterConfig) MatchOperation(operation dockerapi.Operation) bool {
+	if len(fc.Operations) == 0 {
+		return true
+	}
+	for _, id := range fc.Operations {
+		if operation.Is(id) {
+			return true
+		}
+	}
+	return false
+}
+
+func compileValuePatterns(patterns map[string]string) (map[string]*regexp.Regexp, error) {
+	compiled := make(map[string]*regexp.Regexp)
+	for key, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		compiled[key] = regex
+	}
+	return compiled, nil
+}
+
+func matchMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchValues checks that every key is present and, when a pattern is given, that at least one of its values matches
+func matchValues(patterns map[string]string, regexes map[string]*regexp.Regexp, values map[string][]string) bool {
+	for key, pattern := range patterns {
+		candidates := lookupValues(values, key)
+		if candidates == nil {
+			return false
+		}
+		if pattern == "" {
+			continue
+		}
+		regex := regexes[key]
+		if regex == nil {
+			return false
+		}
+		matched := false
+		for _, candidate := range candidates {
+			if regex.MatchString(candidate) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func lookupValues(values map[string][]string, key string) []string {
+	if v, ok := values[key]; ok {
+		return v
+	}
+	if v, ok := values[http.CanonicalHeaderKey(key)]; ok {
+		return v
+	}
+	return nil
+}
@@ -1,15 +1,20 @@
 package filters
 
 import (
+	"errors"
 	"fmt"
 	"github.com/sirupsen/logrus"
 	"net/http"
+	"runtime/debug"
 	"strconv"
 	"time"
 
+	"github.com/labbsr0x/go-horse/dockerapi"
 	filter "github.com/labbsr0x/go-horse/filters/config-filter"
 	"github.com/labbsr0x/go-horse/filters/list"
 	"github.com/labbsr0x/go-horse/filters/model"
+	"github.com/labbsr0x/go-horse/filters/store"
+	"github.com/labbsr0x/go-horse/filters/trace"
 	"github.com/labbsr0x/go-horse/prometheus"
 	"github.com/kataras/iris"
 )
@@ -17,13 +22,22 @@ import (
 type FilterManager struct {
 	*filter.FilterBuilder
 	ListAPIs list.ListAPI
+	Traces   *trace.Recorder
+	Store    store.Store
 }
 
-// InitFromFilterBuilder builds a Filter instance
-func (f  *FilterManager) InitFromFilterBuilder(filterBuilder *filter.FilterBuilder)  *FilterManager {
+// InitFromFilterBuilder builds a Filter instance. It fails when the store can't be opened
+func (f  *FilterManager) InitFromFilterBuilder(filterBuilder *filter.FilterBuilder)  (*FilterManager, error) {
 	f.FilterBuilder = filterBuilder
 	f.ListAPIs = new(list.DefaultListAPI).InitFromFilterBuilder(filterBuilder)
-	return f
+	f.Traces = trace.NewRecorder(filterBuilder.FilterTraceHistory)
+	filterStore, err := store.Open(filterBuilder.StoreBackend, filterBuilder.StorePath)
+	if err != nil {
+		return nil, err
+	}
+	f.Store = filterStore
+	store.SetDefault(filterStore)
+	return f, nil
 }
 
 func (f  *FilterManager) RunRequestFilters(ctx iris.Context, requestBodyKey string) (result model.FilterReturn, err error) {
@@ -35,49 +49,122 @@ func (f  *FilterManager) RunResponseFilters(ctx iris.Context, responseBodyKey st
 }
 
 func (f  *FilterManager) runFilters(ctx iris.Context, bodyKey string, filters []model.Filter) (result model.FilterReturn, err error) {
+	requestTrace := trace.FromContext(ctx, f.Traces)
+
 	for _, filter := range filters {
-		if filter.MatchURL(ctx) {
-			filterConfig := filter.Config()
+		filterConfig := filter.Config()
+		if !(filter.MatchURL(ctx) && filterConfig.MatchOperation(dockerapi.FromContext(ctx)) && filterConfig.MatchRequest(ctx.Request())) {
+			requestTrace.Add(trace.Entry{Filter: filterConfig.Name, Invoke: filterConfig.InvokeName(), Matched: false})
+			continue
+		}
 
-			logrus.WithFields(logrus.Fields{
-				"Filter matched": ctx.String(),
-				"filter_config": fmt.Sprintf("%#v", filterConfig),
-			}).Debugf("Executing %s filter %s...", filterConfig.InvokeName(), filterConfig.Name)
+		logrus.WithFields(logrus.Fields{
+			"Filter matched": ctx.String(),
+			"filter_config": fmt.Sprintf("%#v", filterConfig),
+		}).Debugf("Executing %s filter %s...", filterConfig.InvokeName(), filterConfig.Name)
+
+		start := time.Now()
 
-			start := time.Now()
+		var outcome string
+		body := ctx.Values().GetString(bodyKey)
+		result, outcome, err = execFilter(ctx, filter, filterConfig, body)
+		duration := time.Since(start)
 
-			result, err = filter.Exec(ctx, ctx.Values().GetString(bodyKey))
+		statusCode := strconv.Itoa(result.Status)
+		metrics := prometheus.GetMetrics()
+		metrics.FilterCount.WithLabelValues(filterConfig.Name, filterConfig.InvokeName(), statusCode, outcome, filterConfig.ModeName()).Inc()
+		metrics.FilterLatency.WithLabelValues(filterConfig.Name, filterConfig.InvokeName(), statusCode).
+			Observe(float64(duration.Seconds()) / 1000000000)
 
-			statusCode := strconv.Itoa(result.Status)
-			metrics := prometheus.GetMetrics()
-			metrics.FilterCount.WithLabelValues(filterConfig.Name, filterConfig.InvokeName(), statusCode).Inc()
-			metrics.FilterLatency.WithLabelValues(filterConfig.Name, filterConfig.InvokeName(), statusCode).
-				Observe(float64(time.Since(start).Seconds()) / 1000000000)
+		entry := trace.Entry{
+			Filter:     filterConfig.Name,
+			Invoke:     filterConfig.InvokeName(),
+			Matched:    true,
+			Shadow:     filterConfig.Mode == model.Shadow,
+			DurationMs: float64(duration) / float64(time.Millisecond),
+			Outcome:    outcome,
+			Status:     result.Status,
+			Next:       result.Next,
+			Operation:  result.Operation.String(),
+			Synthetic:  result.Response != nil,
+		}
+		if err != nil {
+			// the traces reach the clients, the script error details only when the clients get them
+			entry.Error = f.clientMessage(err)
+		}
+		if result.Operation == model.Write {
+			entry.BodyDiff = trace.DiffBody(body, result.Body)
+		}
+		requestTrace.Add(entry)
 
+		if filterConfig.Mode == model.Shadow {
+			fields := logrus.Fields{
+				"Filter":    filterConfig.Name,
+				"next":      result.Next,
+				"status":    result.Status,
+				"operation": result.Operation.String(),
+				"outcome":   outcome,
+			}
+			if entry.BodyDiff != nil {
+				fields["bodyDiff"] = fmt.Sprintf("%+v", *entry.BodyDiff)
+			}
 			if err != nil {
-				logrus.WithFields(logrus.Fields{
-					"error": err.Error(),
-				}).Errorf("Error applying filter : %s", filterConfig.Name)
+				fields["error"] = err.Error()
 			}
-
-			logrus.WithFields(logrus.Fields{
-				"Filter output": fmt.Sprintf("%#v", result),
-				"filter_config": fmt.Sprintf("%#v", result),
-			}).Debugf("Filter execution end")
-
+			logrus.WithFields(fields).Infof("Shadow filter result discarded")
 			if result.Operation == model.Write {
 				logrus.WithFields(logrus.Fields{
 					"Filter": filterConfig.Name,
-				}).Debugf("Body rewrite for filte")
-				ctx.Values().Set(bodyKey, result.Body)
+					"body":   result.Body,
+				}).Debugf("Shadow filter would-be body rewrite")
 			}
+			result, err = model.FilterReturn{Next: true, Operation: model.Read}, nil
+			continue
+		}
 
-			if !result.Next {
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err.Error(),
+			}).Errorf("Error applying filter : %s", filterConfig.Name)
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"Filter output": fmt.Sprintf("%#v", result),
+			"filter_config": fmt.Sprintf("%#v", result),
+		}).Debugf("Filter execution end")
+
+		if result.Operation == model.Write {
+			logrus.WithFields(logrus.Fields{
+				"Filter": filterConfig.Name,
+			}).Debugf("Body rewrite for filte")
+			ctx.Values().Set(bodyKey, result.Body)
+		}
+
+		if result.Response != nil {
+			if filterConfig.Invoke == model.Request {
 				logrus.WithFields(logrus.Fields{
 					"Filter": filterConfig.Name,
-				}).Infof("Filter chain canceled by filter")
+					"status": result.Response.Status,
+				}).Infof("Synthetic response returned by filter, the daemon won't be called")
+				ctx.Values().Set(model.SyntheticResponseKey, result.Response)
 				break
 			}
+			logrus.WithFields(logrus.Fields{
+				"Filter": filterConfig.Name,
+			}).Warnf("Synthetic responses are only supported by request filters, ignored")
+		}
+
+		if !result.Headers.IsEmpty() {
+			headersKey := model.HeadersKey(filterConfig.Invoke)
+			headers, _ := ctx.Values().Get(headersKey).(model.HeaderOperations)
+			ctx.Values().Set(headersKey, headers.Merge(result.Headers))
+		}
+
+		if !result.Next {
+			logrus.WithFields(logrus.Fields{
+				"Filter": filterConfig.Name,
+			}).Infof("Filter chain canceled by filter")
+			break
 		}
 	}
 
@@ -85,10 +172,127 @@ func (f  *FilterManager) runFilters(ctx iris.Context, bodyKey string, filters []
 		if result.Status == 0 {
 			result.Status = http.StatusInternalServerError
 		}
+		trace.WriteHeader(ctx)
 		ctx.StatusCode(result.Status)
 		ctx.ContentType("application/json")
-		ctx.WriteString(err.Error())
+		_, _ = ctx.JSON(iris.Map{"message": f.clientMessage(err)})
 	}
 
 	return
 }
+
+// clientMessage the error message sent to the client, without the JS error details if they are disabled
+func (f *FilterManager) clientMessage(err error) string {
+	if scriptErr, ok := err.(*model.ScriptError); ok && !f.JsErrorDetails {
+		return fmt.Sprintf("filter %s failed, see the go-horse logs", scriptErr.Filter)
+	}
+	return err.Error()
+}
+
+// Filter execution outcomes, as labeled in the filter_process_total metric
+const (
+	outcomeSuccess     = "success"
+	outcomeError       = "error"
+	outcomeTimeout     = "timeout"
+	outcomePanic       = "panic"
+	outcomeLimit       = "limit"
+	outcomeUnavailable = "unavailable"
+)
+
+type execution struct {
+	result   model.FilterReturn
+	err      error
+	panicked interface{}
+}
+
+// execFilter executes the filter within its timeout, applying its failure policy if it times out, panics or exceeds a sandbox limit.
+// A filter that times out is canceled, and waited for, so it doesn't use the request context after the chain moved on
+func execFilter(ctx iris.Context, filter model.Filter, filterConfig model.FilterConfig, body string) (model.FilterReturn, string, error) {
+	var exec execution
+
+	if filterConfig.Timeout <= 0 {
+		exec = safeExec(ctx, filter, body, nil)
+	} else {
+		cancel := make(chan struct{})
+		done := make(chan execution, 1)
+		go func() {
+			done <- safeExec(ctx, filter, body, cancel)
+		}()
+		timer := time.NewTimer(filterConfig.Timeout)
+		defer timer.Stop()
+		select {
+		case exec = <-done:
+		case <-timer.C:
+			close(cancel)
+			<-done
+			return filterFailure(filterConfig, outcomeTimeout, http.StatusGatewayTimeout,
+				fmt.Sprintf("filter %s timed out after %v", filterConfig.Name, filterConfig.Timeout))
+		}
+	}
+
+	if exec.panicked != nil {
+		return filterFailure(filterConfig, outcomePanic, http.StatusInternalServerError,
+			fmt.Sprintf("filter %s panicked : %v", filterConfig.Name, exec.panicked))
+	}
+	if limitErr, ok := exec.err.(*model.LimitError); ok {
+		return filterFailure(filterConfig, outcomeLimit, http.StatusInternalServerError, limitErr.Error())
+	}
+	if unavailableErr, ok := exec.err.(*model.UnavailableError); ok {
+		return filterFailure(filterConfig, outcomeUnavailable, http.StatusServiceUnavailable, unavailableErr.Error())
+	}
+	if exec.err != nil {
+		return exec.result, outcomeError, exec.err
+	}
+	// the Go filters return their synthetic responses as is
+	if exec.result.Response != nil {
+		if err := exec.result.Response.CheckStatus(); err != nil {
+			return model.FilterReturn{Next: false}, outcomeError, fmt.Errorf("filter %s : %v", filterConfig.Name, err)
+		}
+	}
+	return exec.result, outcomeSuccess, nil
+}
+
+// safeExec executes the filter, recovering its panics. Cancelable filters are stopped when cancel is closed
+func safeExec(ctx iris.Context, filter model.Filter, body string, cancel <-chan struct{}) (exec execution) {
+	defer func() {
+		if r := recover(); r != nil {
+			logrus.WithFields(logrus.Fields{
+				"panic": fmt.Sprintf("%v", r),
+				"stack": string(debug.Stack()),
+			}).Errorf("Filter panic recovered : %s", filter.Config().Name)
+			exec.panicked = r
+		}
+	}()
+	if cancelable, ok := filter.(model.Cancelable); ok && cancel != nil {
+		exec.result, exec.err = cancelable.ExecCancelable(ctx, body, cancel)
+	} else {
+		exec.result, exec.err = filter.Exec(ctx, body)
+	}
+	return
+}
+
+// filterFailure denies the request or skips the filter, according to the filter failure policy
+func filterFailure(filterConfig model.FilterConfig, outcome string, defaultStatus int, reason string) (model.FilterReturn, string, error) {
+	if filterConfig.OnFailure == model.Skip {
+		logrus.WithFields(logrus.Fields{
+			"Filter": filterConfig.Name,
+			"reason": reason,
+		}).Warnf("Failing filter skipped")
+		return model.FilterReturn{Next: true, Operation: model.Read}, outcome, nil
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"Filter": filterConfig.Name,
+		"reason": reason,
+	}).Errorf("Request denied by failing filter")
+
+	status := filterConfig.FailureStatus
+	if status == 0 {
+		status = defaultStatus
+	}
+	message := filterConfig.FailureMessage
+	if message == "" {
+		message = reason
+	}
+	return model.FilterReturn{Next: false, Status: status, Body: message, Operation: model.Read}, outcome, errors.New(message)
+}
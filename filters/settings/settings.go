@@ -0,0 +1,84 @@
+package settings
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Extensions extensions of the settings sidecar files, in lookup order
+var Extensions = []string{".yaml", ".yml", ".json"}
+
+// IsSettingsFile tells if the file is a settings sidecar file rather than a filter
+func IsSettingsFile(fileName string) bool {
+	ext := filepath.Ext(fileName)
+	for _, candidate := range Extensions {
+		if ext == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// Load reads the settings of a filter from its sidecar file : the filter file path with a .yaml, .yml or .json extension,
+// like 010.request.acl.yaml next to 010.request.acl.js. Returns nil settings and an empty file name without a sidecar file
+func Load(filterFile string) (map[string]interface{}, string, error) {
+	base := strings.TrimSuffix(filterFile, filepath.Ext(filterFile))
+	for _, ext := range Extensions {
+		file := base + ext
+		content, err := ioutil.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, file, err
+		}
+		settings, err := parse(ext, content)
+		if err != nil {
+			return nil, file, err
+		}
+		return settings, file, nil
+	}
+	return nil, "", nil
+}
+
+func parse(ext string, content []byte) (map[string]interface{}, error) {
+	settings := make(map[string]interface{})
+	if ext == ".json" {
+		if err := json.Unmarshal(content, &settings); err != nil {
+			return nil, err
+		}
+		return settings, nil
+	}
+	var raw map[interface{}]interface{}
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		return nil, err
+	}
+	for key, value := range raw {
+		settings[fmt.Sprint(key)] = Normalize(value)
+	}
+	return settings, nil
+}
+
+// Normalize turns the YAML maps into string keyed maps, so the settings can be encoded as JSON
+func Normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = Normalize(item)
+		}
+		return m
+	case []interface{}:
+		for i, item := range v {
+			v[i] = Normalize(item)
+		}
+		return v
+	}
+	return value
+}
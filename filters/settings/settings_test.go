@@ -0,0 +1,47 @@
+package settings
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "settings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	yamlSettings := "allowed:\n  - registry.local/\nlimits:\n  cpu: 2\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "010.request.acl.yaml"), []byte(yamlSettings), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "quota.json"), []byte(`{"max": 3}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	values, file, err := Load(filepath.Join(dir, "010.request.acl.js"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"allowed": []interface{}{"registry.local/"},
+		"limits":  map[string]interface{}{"cpu": 2},
+	}
+	if !reflect.DeepEqual(values, expected) || filepath.Base(file) != "010.request.acl.yaml" {
+		t.Errorf("expected %v from the yaml file, got %v from %s", expected, values, file)
+	}
+
+	values, _, err = Load(filepath.Join(dir, "quota.so"))
+	if err != nil || values["max"] != float64(3) {
+		t.Errorf("expected the json settings, got %v, %v", values, err)
+	}
+
+	values, file, err = Load(filepath.Join(dir, "020.request.none.js"))
+	if values != nil || file != "" || err != nil {
+		t.Errorf("expected no settings without a settings file, got %v, %q, %v", values, file, err)
+	}
+}
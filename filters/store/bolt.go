@@ -0,0 +1,164 @@
+package store
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltBucket bucket of the values in the bolt file
+var boltBucket = []byte("values")
+
+// boltOpenTimeout how long opening waits for the file lock, held by another go-horse using the same file
+const boltOpenTimeout = 5 * time.Second
+
+// boltStore the values in a bbolt file, each one prefixed by its expiration in unix nanoseconds, 0 if it never expires.
+// The expired values are swept every sweepInterval
+type boltStore struct {
+	db   *bolt.DB
+	stop chan struct{}
+	once sync.Once
+}
+
+func openBoltStore(path string) (*boltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("error opening the store file %s : %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("error creating the store bucket in %s : %v", path, err)
+	}
+	s := &boltStore{db: db, stop: make(chan struct{})}
+	go s.sweeper()
+	return s, nil
+}
+
+func (s *boltStore) sweeper() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.sweep(time.Now()); err != nil {
+				logrus.WithFields(logrus.Fields{
+					"error": err.Error(),
+				}).Errorf("Error removing the expired values - store sweep")
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *boltStore) sweep(now time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(boltBucket).Cursor()
+		for key, record := cursor.First(); key != nil; key, record = cursor.Next() {
+			if expires, _ := unpack(record); expired(expires, now) {
+				if err := cursor.Delete(); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func pack(value []byte, expires time.Time) []byte {
+	record := make([]byte, 8+len(value))
+	if !expires.IsZero() {
+		binary.BigEndian.PutUint64(record, uint64(expires.UnixNano()))
+	}
+	copy(record[8:], value)
+	return record
+}
+
+func unpack(record []byte) (time.Time, []byte) {
+	if len(record) < 8 {
+		return time.Time{}, nil
+	}
+	var expires time.Time
+	if nanos := binary.BigEndian.Uint64(record); nanos != 0 {
+		expires = time.Unix(0, int64(nanos))
+	}
+	return expires, record[8:]
+}
+
+// live the expiration and the value of the key, a nil value if not set or expired. The value is only valid during the transaction
+func live(tx *bolt.Tx, key string, now time.Time) (time.Time, []byte) {
+	record := tx.Bucket(boltBucket).Get([]byte(key))
+	if record == nil {
+		return time.Time{}, nil
+	}
+	expires, value := unpack(record)
+	if expired(expires, now) {
+		return time.Time{}, nil
+	}
+	return expires, value
+}
+
+func (s *boltStore) Get(key string) (interface{}, bool, error) {
+	var value interface{}
+	found := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		_, encoded := live(tx, key, time.Now())
+		if encoded == nil {
+			return nil
+		}
+		var err error
+		value, err = decode(encoded)
+		found = err == nil
+		return err
+	})
+	return value, found, err
+}
+
+func (s *boltStore) Set(key string, value interface{}, ttl time.Duration) error {
+	encoded, err := encode(value)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Put([]byte(key), pack(encoded, expiration(time.Now(), ttl)))
+	})
+}
+
+func (s *boltStore) Delete(key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Delete([]byte(key))
+	})
+}
+
+func (s *boltStore) Incr(key string, delta float64, ttl time.Duration) (float64, error) {
+	var number float64
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		now := time.Now()
+		expires, encoded := live(tx, key, now)
+		if encoded == nil {
+			expires = expiration(now, ttl)
+		}
+		var err error
+		if number, err = increment(encoded, delta); err != nil {
+			return err
+		}
+		if encoded, err = encode(number); err != nil {
+			return err
+		}
+		return tx.Bucket(boltBucket).Put([]byte(key), pack(encoded, expires))
+	})
+	return number, err
+}
+
+func (s *boltStore) Close() error {
+	s.once.Do(func() { close(s.stop) })
+	return s.db.Close()
+}
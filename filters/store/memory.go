@@ -0,0 +1,110 @@
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// memoryStore the values in a map, swept of the expired ones every sweepInterval
+type memoryStore struct {
+	mutex   sync.Mutex
+	entries map[string]memoryEntry
+	stop    chan struct{}
+	once    sync.Once
+}
+
+func newMemoryStore() *memoryStore {
+	s := &memoryStore{entries: make(map[string]memoryEntry), stop: make(chan struct{})}
+	go s.sweeper()
+	return s
+}
+
+func (s *memoryStore) sweeper() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.sweep(time.Now())
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *memoryStore) sweep(now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for key, entry := range s.entries {
+		if expired(entry.expires, now) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// entry the live entry of the key, the lock must be held
+func (s *memoryStore) entry(key string, now time.Time) (memoryEntry, bool) {
+	entry, ok := s.entries[key]
+	if !ok || expired(entry.expires, now) {
+		return memoryEntry{}, false
+	}
+	return entry, true
+}
+
+func (s *memoryStore) Get(key string) (interface{}, bool, error) {
+	s.mutex.Lock()
+	entry, ok := s.entry(key, time.Now())
+	s.mutex.Unlock()
+	if !ok {
+		return nil, false, nil
+	}
+	value, err := decode(entry.value)
+	return value, err == nil, err
+}
+
+func (s *memoryStore) Set(key string, value interface{}, ttl time.Duration) error {
+	encoded, err := encode(value)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.entries[key] = memoryEntry{value: encoded, expires: expiration(time.Now(), ttl)}
+	return nil
+}
+
+func (s *memoryStore) Delete(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *memoryStore) Incr(key string, delta float64, ttl time.Duration) (float64, error) {
+	now := time.Now()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entry, ok := s.entry(key, now)
+	if !ok {
+		entry = memoryEntry{expires: expiration(now, ttl)}
+	}
+	number, err := increment(entry.value, delta)
+	if err != nil {
+		return 0, err
+	}
+	if entry.value, err = encode(number); err != nil {
+		return 0, err
+	}
+	s.entries[key] = entry
+	return number, nil
+}
+
+func (s *memoryStore) Close() error {
+	s.once.Do(func() { close(s.stop) })
+	return nil
+}
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Backends of the store
+const (
+	// Memory values kept in memory, lost on restart
+	Memory = "memory"
+	// Bolt values kept in a bbolt file, surviving restarts
+	Bolt = "bolt"
+)
+
+// sweepInterval how often the expired values are removed. They are not returned once expired, even before a sweep
+const sweepInterval = time.Minute
+
+var (
+	// ErrNoStore returned by the calls made before the store is set
+	ErrNoStore = errors.New("the store is not available yet")
+	// ErrNotNumber returned by Incr when the value of the key is not a number
+	ErrNotNumber = errors.New("the value is not a number")
+)
+
+// Store a key-value store shared by the filters, whose values outlive the requests. Values are copied as JSON :
+// strings, numbers, booleans, arrays and objects. A value set with a TTL expires after it, a zero TTL never expires
+type Store interface {
+	// Get the value of the key, false if not set or expired
+	Get(key string) (interface{}, bool, error)
+	// Set sets the value of the key, expiring after the TTL
+	Set(key string, value interface{}, ttl time.Duration) error
+	// Delete removes the key
+	Delete(key string) error
+	// Incr adds delta to the number of the key and returns it. A missing or expired key starts from zero and expires
+	// after the TTL, an existing key keeps its expiration : incrementing a key doesn't extend its life
+	Incr(key string, delta float64, ttl time.Duration) (float64, error)
+	// Close releases the store
+	Close() error
+}
+
+var defaultStore Store
+
+// Open opens the store of the backend, memory if empty. The bolt backend keeps the values in the file of the path
+func Open(backend, path string) (Store, error) {
+	switch backend {
+	case Memory, "":
+		return newMemoryStore(), nil
+	case Bolt:
+		if path == "" {
+			return nil, fmt.Errorf("the %s store needs a file path", Bolt)
+		}
+		return openBoltStore(path)
+	}
+	return nil, fmt.Errorf("unknown store backend %q, expected %s or %s", backend, Memory, Bolt)
+}
+
+// SetDefault sets the store used by the filters
+func SetDefault(store Store) {
+	defaultStore = store
+}
+
+// Default the store used by the filters, nil until go-horse sets it
+func Default() Store {
+	return defaultStore
+}
+
+// Get the value of the key in the default store, false if not set or expired
+func Get(key string) (interface{}, bool, error) {
+	if defaultStore == nil {
+		return nil, false, ErrNoStore
+	}
+	return defaultStore.Get(key)
+}
+
+// Set sets the value of the key in the default store, expiring after the TTL
+func Set(key string, value interface{}, ttl time.Duration) error {
+	if defaultStore == nil {
+		return ErrNoStore
+	}
+	return defaultStore.Set(key, value, ttl)
+}
+
+// Delete removes the key from the default store
+func Delete(key string) error {
+	if defaultStore == nil {
+		return ErrNoStore
+	}
+	return defaultStore.Delete(key)
+}
+
+// Incr adds delta to the number of the key in the default store and returns it, see Store.Incr
+func Incr(key string, delta float64, ttl time.Duration) (float64, error) {
+	if defaultStore == nil {
+		return 0, ErrNoStore
+	}
+	return defaultStore.Incr(key, delta, ttl)
+}
+
+// expiration the expiration time of a TTL, zero if it never expires
+func expiration(now time.Time, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return now.Add(ttl)
+}
+
+func expired(expires, now time.Time) bool {
+	return !expires.IsZero() && !now.Before(expires)
+}
+
+func encode(value interface{}) ([]byte, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("the value can't be stored as JSON : %v", err)
+	}
+	return encoded, nil
+}
+
+func decode(encoded []byte) (interface{}, error) {
+	var value interface{}
+	err := json.Unmarshal(encoded, &value)
+	return value, err
+}
+
+// increment the encoded number plus delta, delta if there is no number yet
+func increment(encoded []byte, delta float64) (float64, error) {
+	if encoded == nil {
+		return delta, nil
+	}
+	value, err := decode(encoded)
+	if err != nil {
+		return 0, err
+	}
+	number, ok := value.(float64)
+	if !ok {
+		return 0, ErrNotNumber
+	}
+	return number + delta, nil
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testStore(t *testing.T, s Store) {
+	if err := s.Set("identity", map[string]interface{}{"user": "ana", "teams": []string{"ops"}}, 0); err != nil {
+		t.Fatal(err)
+	}
+	value, found, err := s.Get("identity")
+	expected := map[string]interface{}{"user": "ana", "teams": []interface{}{"ops"}}
+	if err != nil || !found || !reflect.DeepEqual(value, expected) {
+		t.Errorf("expected %v, got %v, %t, %v", expected, value, found, err)
+	}
+
+	if err := s.Set("token", "abc", 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := s.Incr("requests", 1, 20*time.Millisecond); err != nil || count != 1 {
+		t.Errorf("expected the first incr to return 1, got %v, %v", count, err)
+	}
+	if count, err := s.Incr("requests", 2, time.Hour); err != nil || count != 3 {
+		t.Errorf("expected the second incr to return 3, got %v, %v", count, err)
+	}
+	if _, err := s.Incr("token", 1, 0); err != ErrNotNumber {
+		t.Errorf("expected ErrNotNumber incrementing a string, got %v", err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, found, _ := s.Get("token"); found {
+		t.Errorf("expected the token to be expired")
+	}
+	if count, err := s.Incr("requests", 1, 0); err != nil || count != 1 {
+		t.Errorf("expected the incr to keep the first TTL and restart from zero, got %v, %v", count, err)
+	}
+
+	if err := s.Delete("identity"); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := s.Get("identity"); found {
+		t.Errorf("expected the identity to be deleted")
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	s, err := Open(Memory, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	testStore(t, s)
+}
+
+func TestBoltStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "go-horse.db")
+
+	s, err := Open(Bolt, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+	if err := s.Set("first-seen", 1547137303, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = Open(Bolt, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if value, found, err := s.Get("first-seen"); err != nil || !found || value != float64(1547137303) {
+		t.Errorf("expected the value to survive the restart, got %v, %t, %v", value, found, err)
+	}
+}
@@ -0,0 +1,62 @@
+package trace
+
+import (
+	"sync"
+)
+
+// Recorder keeps the traces of the last requests
+type Recorder struct {
+	size   int
+	traces []*Trace
+	next   int
+	mutex  sync.Mutex
+}
+
+// NewRecorder creates a recorder keeping the last size traces, nothing is kept if size is zero
+func NewRecorder(size int) *Recorder {
+	return &Recorder{size: size}
+}
+
+// Add records a trace, replacing the oldest one when the recorder is full
+func (r *Recorder) Add(trace *Trace) {
+	if r == nil || r.size <= 0 {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(r.traces) < r.size {
+		r.traces = append(r.traces, trace)
+		return
+	}
+	r.traces[r.next] = trace
+	r.next = (r.next + 1) % r.size
+}
+
+// List the recorded traces, newest first
+func (r *Recorder) List() []Trace {
+	if r == nil {
+		return nil
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	list := make([]Trace, 0, len(r.traces))
+	for i := len(r.traces) - 1; i >= 0; i-- {
+		list = append(list, r.traces[(r.next+i)%len(r.traces)].Snapshot())
+	}
+	return list
+}
+
+// Get a recorded trace by its ID
+func (r *Recorder) Get(id string) (Trace, bool) {
+	if r == nil {
+		return Trace{}, false
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, trace := range r.traces {
+		if trace.ID == id {
+			return trace.Snapshot(), true
+		}
+	}
+	return Trace{}, false
+}
@@ -0,0 +1,157 @@
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kataras/iris"
+	"github.com/labbsr0x/go-horse/dockerapi"
+	"github.com/labbsr0x/go-horse/util"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Header request header opting in the trace, and response header carrying it
+	Header = "X-GoHorse-Trace"
+	// Key request scope key where the trace of the request is kept
+	Key = "filterTrace"
+)
+
+func init() {
+	util.ProtectRequestScopeKeys(Key)
+}
+
+// Entry the evaluation of a filter
+type Entry struct {
+	Filter     string    `json:"filter"`
+	Invoke     string    `json:"invoke"`
+	Matched    bool      `json:"matched"`
+	Shadow     bool      `json:"shadow,omitempty"`
+	DurationMs float64   `json:"durationMs,omitempty"`
+	Outcome    string    `json:"outcome,omitempty"`
+	Status     int       `json:"status,omitempty"`
+	Next       bool      `json:"next"`
+	Operation  string    `json:"operation,omitempty"`
+	Synthetic  bool      `json:"synthetic,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	BodyDiff   *BodyDiff `json:"bodyDiff,omitempty"`
+}
+
+// BodyDiff summary of a body rewrite
+type BodyDiff struct {
+	SizeBefore int      `json:"sizeBefore"`
+	SizeAfter  int      `json:"sizeAfter"`
+	Added      []string `json:"added,omitempty"`
+	Removed    []string `json:"removed,omitempty"`
+	Changed    []string `json:"changed,omitempty"`
+}
+
+// Trace the filters evaluated for a request
+type Trace struct {
+	ID        string    `json:"id"`
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Operation string    `json:"operation,omitempty"`
+	Entries   []Entry   `json:"entries"`
+	mutex     *sync.Mutex
+}
+
+// FromContext returns the trace of the request, creating and recording it on the first call
+func FromContext(ctx iris.Context, recorder *Recorder) *Trace {
+	if trace, ok := ctx.Values().Get(Key).(*Trace); ok {
+		return trace
+	}
+	trace := &Trace{
+		ID:        newID(),
+		Time:      time.Now(),
+		Method:    ctx.Method(),
+		Path:      ctx.Request().URL.Path,
+		Operation: dockerapi.FromContext(ctx).ID,
+		mutex:     &sync.Mutex{},
+	}
+	ctx.Values().Set(Key, trace)
+	recorder.Add(trace)
+	return trace
+}
+
+// Add appends a filter evaluation to the trace
+func (t *Trace) Add(entry Entry) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.Entries = append(t.Entries, entry)
+}
+
+// Snapshot a copy of the trace, safe to be read while the request goes on
+func (t *Trace) Snapshot() Trace {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return Trace{
+		ID:        t.ID,
+		Time:      t.Time,
+		Method:    t.Method,
+		Path:      t.Path,
+		Operation: t.Operation,
+		Entries:   append([]Entry{}, t.Entries...),
+	}
+}
+
+// WriteHeader sets the trace response header if the client asked for it
+func WriteHeader(ctx iris.Context) {
+	if ctx.GetHeader(Header) == "" {
+		return
+	}
+	trace, ok := ctx.Values().Get(Key).(*Trace)
+	if !ok {
+		return
+	}
+	snapshot := trace.Snapshot()
+	value, err := json.Marshal(&snapshot)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Errorf("Error encoding the filter trace header")
+		return
+	}
+	ctx.ResponseWriter().Header().Set(Header, string(value))
+}
+
+// DiffBody summarizes the changes between two bodies, by top level keys when both are JSON objects
+func DiffBody(before, after string) *BodyDiff {
+	diff := &BodyDiff{SizeBefore: len(before), SizeAfter: len(after)}
+
+	var beforeObj, afterObj map[string]interface{}
+	if json.Unmarshal([]byte(before), &beforeObj) != nil || json.Unmarshal([]byte(after), &afterObj) != nil {
+		return diff
+	}
+	for key, value := range afterObj {
+		old, ok := beforeObj[key]
+		if !ok {
+			diff.Added = append(diff.Added, key)
+		} else if !reflect.DeepEqual(old, value) {
+			diff.Changed = append(diff.Changed, key)
+		}
+	}
+	for key := range beforeObj {
+		if _, ok := afterObj[key]; !ok {
+			diff.Removed = append(diff.Removed, key)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	return diff
+}
+
+func newID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(id)
+}
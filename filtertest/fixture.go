@@ -0,0 +1,151 @@
+package filtertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/labbsr0x/go-horse/filters/settings"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Fixture a test of the filter chain : the request sent by the client, the response of the mocked daemon and the expected results
+type Fixture struct {
+	Name    string  `json:"name"`
+	Request Request `json:"request"`
+	// Daemon the mocked daemon response, a 200 with an empty JSON object if not set
+	Daemon *Daemon `json:"daemon"`
+	// Docker the responses of the mocked daemon to the ctx.docker calls of the filters, by path without the API version,
+	// like /containers/abc/json. A 404 for the paths not set
+	Docker map[string]Daemon `json:"docker"`
+	Expect Expect            `json:"expect"`
+}
+
+// Request the request sent by the client
+type Request struct {
+	// Method GET if empty
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
+	// Body sent as is when it is a string, encoded as JSON otherwise
+	Body interface{} `json:"body"`
+}
+
+// Daemon the response of the mocked daemon
+type Daemon struct {
+	// Status 200 if zero
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	// Body sent as is when it is a string, encoded as JSON otherwise
+	Body interface{} `json:"body"`
+}
+
+// Expect the expected results of the filter chain, only the ones set are checked
+type Expect struct {
+	// Status status code of the response sent to the client
+	Status int `json:"status"`
+	// Next false if a filter stopped the request or the response filter chain
+	Next *bool `json:"next"`
+	// Body body of the response sent to the client : compared as text if it is a string, as JSON otherwise
+	Body interface{} `json:"body"`
+	// Headers headers of the response sent to the client
+	Headers map[string]string `json:"headers"`
+	// Values values of the request scope, compared as JSON
+	Values map[string]interface{} `json:"values"`
+	// DaemonCalled tells if the request was sent to the daemon
+	DaemonCalled *bool `json:"daemonCalled"`
+	// DaemonRequest the request received by the daemon
+	DaemonRequest *DaemonRequest `json:"daemonRequest"`
+}
+
+// DaemonRequest the expected request received by the daemon, only the fields set are checked
+type DaemonRequest struct {
+	// Path path and query of the request
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
+	// Body compared as text if it is a string, as JSON otherwise
+	Body interface{} `json:"body"`
+}
+
+// Extensions extensions of the fixture files
+var Extensions = []string{".yaml", ".yml", ".json"}
+
+// FixtureFiles the fixture files of the paths, the directories are walked in any depth
+func FixtureFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		err := filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			if file == path || isFixtureFile(file) {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func isFixtureFile(file string) bool {
+	ext := filepath.Ext(file)
+	for _, candidate := range Extensions {
+		if ext == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadFixtures reads a YAML or JSON fixture file, holding one fixture or a list of fixtures
+func LoadFixtures(file string) ([]Fixture, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	// YAML reads JSON too
+	var raw interface{}
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(settings.Normalize(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	var fixtures []Fixture
+	if _, isList := raw.([]interface{}); isList {
+		err = json.Unmarshal(encoded, &fixtures)
+	} else {
+		fixtures = make([]Fixture, 1)
+		err = json.Unmarshal(encoded, &fixtures[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range fixtures {
+		if fixtures[i].Name == "" {
+			fixtures[i].Name = fmt.Sprintf("%s #%d", filepath.Base(file), i+1)
+		}
+	}
+	return fixtures, nil
+}
+
+// check the fixture can be run
+func (f Fixture) check() error {
+	if f.Request.Path == "" {
+		return fmt.Errorf("the request path is missing")
+	}
+	return nil
+}
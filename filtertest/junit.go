@@ -0,0 +1,91 @@
+package filtertest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Suite the results of a fixture file
+type Suite struct {
+	Name    string
+	Results []Result
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func seconds(duration time.Duration) string {
+	return fmt.Sprintf("%.3f", duration.Seconds())
+}
+
+// WriteJUnit writes the results as a JUnit XML report, a test suite per fixture file
+func WriteJUnit(w io.Writer, suites []Suite) error {
+	report := junitTestSuites{}
+	var total time.Duration
+	for _, suite := range suites {
+		junitSuite := junitTestSuite{Name: suite.Name}
+		var suiteTime time.Duration
+		for _, result := range suite.Results {
+			testCase := junitTestCase{Name: result.Name, Classname: suite.Name, Time: seconds(result.Duration)}
+			if result.Error != nil {
+				testCase.Error = &junitProblem{Message: result.Error.Error(), Text: result.Error.Error()}
+				junitSuite.Errors++
+			} else if len(result.Failures) > 0 {
+				testCase.Failure = &junitProblem{Message: result.Failures[0], Text: strings.Join(result.Failures, "\n")}
+				junitSuite.Failures++
+			}
+			junitSuite.Tests++
+			junitSuite.Cases = append(junitSuite.Cases, testCase)
+			suiteTime += result.Duration
+		}
+		junitSuite.Time = seconds(suiteTime)
+		report.Tests += junitSuite.Tests
+		report.Failures += junitSuite.Failures
+		report.Errors += junitSuite.Errors
+		report.Suites = append(report.Suites, junitSuite)
+		total += suiteTime
+	}
+	report.Time = seconds(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,330 @@
+package filtertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api"
+	"github.com/docker/docker/client"
+	"github.com/kataras/iris"
+	"github.com/labbsr0x/go-horse/filters"
+	filterdocker "github.com/labbsr0x/go-horse/filters/docker"
+	"github.com/labbsr0x/go-horse/filters/store"
+	"github.com/labbsr0x/go-horse/filters/trace"
+	"github.com/labbsr0x/go-horse/util"
+	"github.com/labbsr0x/go-horse/web"
+	webConfig "github.com/labbsr0x/go-horse/web/config-web"
+)
+
+// Result the result of a fixture
+type Result struct {
+	Name     string
+	Duration time.Duration
+	// Failures the expectations not met
+	Failures []string
+	// Error the fixture couldn't be run
+	Error error
+}
+
+// Passed tells if the fixture ran and met its expectations
+func (r Result) Passed() bool {
+	return r.Error == nil && len(r.Failures) == 0
+}
+
+// dockerCallHeader tells the ctx.docker calls of the filters apart from the requests proxied to the mocked daemon
+const dockerCallHeader = "X-Filtertest-Docker-Call"
+
+// versionPrefix the API version of a daemon path, like /v1.39
+var versionPrefix = regexp.MustCompile(`^/v[0-9.]+`)
+
+// received the request received by the mocked daemon
+type received struct {
+	path    string
+	headers http.Header
+	body    string
+}
+
+// Runner runs the fixtures through the go-horse application, the filters of the filter manager and a mocked daemon.
+// The fixtures are run one at a time. While the runner is open, the filters use its docker client and its memory store
+type Runner struct {
+	app    *iris.Application
+	daemon *httptest.Server
+	store  store.Store
+	// previous the docker client and the store of the filters before the runner
+	previousStore  store.Store
+	previousClient *client.Client
+
+	mutex    sync.Mutex
+	response *Daemon
+	docker   map[string]Daemon
+	received *received
+	values   map[string]interface{}
+	trace    *trace.Trace
+}
+
+// NewRunner starts the mocked daemon and builds the go-horse application around the loaded filters of the filter manager
+func NewRunner(filter *filters.FilterManager, logLevel string) (*Runner, error) {
+	r := &Runner{}
+	r.daemon = httptest.NewServer(http.HandlerFunc(r.serveDaemon))
+
+	// the handlers streaming from the daemon, like logs and attach, and the ctx.docker calls of the filters reach the
+	// mocked daemon too
+	host := "tcp://" + r.daemon.Listener.Addr().String()
+	dockerCli, err := client.NewClientWithOpts(client.WithHost(host), client.WithVersion(api.DefaultVersion))
+	if err != nil {
+		r.daemon.Close()
+		return nil, err
+	}
+	filtersCli, err := client.NewClientWithOpts(client.WithHost(host), client.WithVersion(api.DefaultVersion),
+		client.WithHTTPHeaders(map[string]string{dockerCallHeader: "true"}))
+	if err != nil {
+		r.daemon.Close()
+		return nil, err
+	}
+
+	webBuilder := &webConfig.WebBuilder{
+		Flags: &webConfig.Flags{
+			TargetHostName: r.daemon.URL,
+			LogLevel:       logLevel,
+		},
+		DockerCli:  dockerCli,
+		SockClient: r.daemon.Client(),
+		Filter:     filter,
+	}
+	r.app = new(web.Server).InitFromWebBuilder(webBuilder).App()
+	r.app.UseGlobal(r.capture)
+	if err := r.app.Build(); err != nil {
+		r.daemon.Close()
+		return nil, err
+	}
+
+	// the fixtures never write to the store of the filter manager, like the bolt file of a running go-horse
+	r.store, _ = store.Open(store.Memory, "")
+	r.previousStore, r.previousClient = store.Default(), filterdocker.Client()
+	store.SetDefault(r.store)
+	filterdocker.SetClient(filtersCli)
+	return r, nil
+}
+
+// Close stops the mocked daemon and gives the filters their docker client and store back
+func (r *Runner) Close() {
+	store.SetDefault(r.previousStore)
+	filterdocker.SetClient(r.previousClient)
+	_ = r.store.Close()
+	r.daemon.Close()
+}
+
+// capture keeps the request scope values and the filters trace once the request is handled
+func (r *Runner) capture(ctx iris.Context) {
+	ctx.Next()
+	r.values = util.RequestScopeValues(ctx)
+	r.trace, _ = ctx.Values().Get(trace.Key).(*trace.Trace)
+}
+
+func (r *Runner) serveDaemon(w http.ResponseWriter, req *http.Request) {
+	if req.Header.Get(dockerCallHeader) != "" {
+		r.serveDockerCall(w, req)
+		return
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	r.received = &received{path: req.URL.RequestURI(), headers: req.Header, body: string(body)}
+
+	response := r.response
+	if response == nil {
+		response = &Daemon{Body: map[string]interface{}{}}
+	}
+	writeDaemonResponse(w, response)
+}
+
+// serveDockerCall answers a ctx.docker call of a filter with the fixture response of its path
+func (r *Runner) serveDockerCall(w http.ResponseWriter, req *http.Request) {
+	path := versionPrefix.ReplaceAllString(req.URL.Path, "")
+	response, ok := r.docker[path]
+	if !ok {
+		response = Daemon{Status: http.StatusNotFound, Body: map[string]interface{}{"message": "no fixture response for " + path}}
+	}
+	writeDaemonResponse(w, &response)
+}
+
+func writeDaemonResponse(w http.ResponseWriter, response *Daemon) {
+	responseBody, err := encodeBody(response.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	for key, value := range response.Headers {
+		w.Header().Set(key, value)
+	}
+	status := response.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(responseBody))
+}
+
+// Run sends the fixture request through the filters and checks the expectations
+func (r *Runner) Run(fixture Fixture) (result Result) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	result.Name = fixture.Name
+	start := time.Now()
+	defer func() {
+		result.Duration = time.Since(start)
+	}()
+
+	if err := fixture.check(); err != nil {
+		result.Error = err
+		return
+	}
+	body, err := encodeBody(fixture.Request.Body)
+	if err != nil {
+		result.Error = fmt.Errorf("error encoding the request body : %v", err)
+		return
+	}
+	method := fixture.Request.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	request := httptest.NewRequest(strings.ToUpper(method), fixture.Request.Path, strings.NewReader(body))
+	if _, isText := fixture.Request.Body.(string); !isText && fixture.Request.Body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	for key, value := range fixture.Request.Headers {
+		request.Header.Set(key, value)
+	}
+
+	r.response, r.docker, r.received, r.values, r.trace = fixture.Daemon, fixture.Docker, nil, nil, nil
+	recorder := httptest.NewRecorder()
+	r.app.ServeHTTP(recorder, request)
+
+	result.Failures = r.check(fixture.Expect, recorder)
+	return
+}
+
+func (r *Runner) check(expect Expect, recorder *httptest.ResponseRecorder) []string {
+	var failures []string
+	fail := func(format string, args ...interface{}) {
+		failures = append(failures, fmt.Sprintf(format, args...))
+	}
+
+	if expect.Status != 0 && recorder.Code != expect.Status {
+		fail("status : expected %d, got %d", expect.Status, recorder.Code)
+	}
+	if expect.Next != nil && r.next() != *expect.Next {
+		fail("next : expected %t, got %t", *expect.Next, r.next())
+	}
+	if expect.Body != nil {
+		if message, ok := matchBody(expect.Body, recorder.Body.String()); !ok {
+			fail("body : %s", message)
+		}
+	}
+	for key, value := range expect.Headers {
+		if actual := recorder.Header().Get(key); actual != value {
+			fail("header %s : expected %q, got %q", key, value, actual)
+		}
+	}
+	for key, value := range expect.Values {
+		actual, ok := r.values[key]
+		if !ok {
+			fail("value %s : expected %s, not set", key, toJSON(value))
+			continue
+		}
+		if !equalJSON(value, actual) {
+			fail("value %s : expected %s, got %s", key, toJSON(value), toJSON(actual))
+		}
+	}
+	if expect.DaemonCalled != nil && (r.received != nil) != *expect.DaemonCalled {
+		fail("daemonCalled : expected %t, got %t", *expect.DaemonCalled, r.received != nil)
+	}
+	if expected := expect.DaemonRequest; expected != nil {
+		if r.received == nil {
+			fail("daemonRequest : the daemon wasn't called")
+			return failures
+		}
+		if expected.Path != "" && r.received.path != expected.Path {
+			fail("daemonRequest path : expected %q, got %q", expected.Path, r.received.path)
+		}
+		for key, value := range expected.Headers {
+			if actual := r.received.headers.Get(key); actual != value {
+				fail("daemonRequest header %s : expected %q, got %q", key, value, actual)
+			}
+		}
+		if expected.Body != nil {
+			if message, ok := matchBody(expected.Body, r.received.body); !ok {
+				fail("daemonRequest body : %s", message)
+			}
+		}
+	}
+	return failures
+}
+
+// next false if a matched filter, not in shadow mode, stopped the request or the response filter chain
+func (r *Runner) next() bool {
+	if r.trace == nil {
+		return true
+	}
+	for _, entry := range r.trace.Snapshot().Entries {
+		if entry.Matched && !entry.Shadow && !entry.Next {
+			return false
+		}
+	}
+	return true
+}
+
+// matchBody compares the body as text if the expected body is a string, as JSON otherwise
+func matchBody(expected interface{}, actual string) (string, bool) {
+	if text, ok := expected.(string); ok {
+		if text != actual {
+			return fmt.Sprintf("expected %q, got %q", text, actual), false
+		}
+		return "", true
+	}
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(actual), &decoded); err != nil {
+		return fmt.Sprintf("expected %s, got a non JSON body %q", toJSON(expected), actual), false
+	}
+	if !equalJSON(expected, decoded) {
+		return fmt.Sprintf("expected %s, got %s", toJSON(expected), actual), false
+	}
+	return "", true
+}
+
+// equalJSON compares the values as encoded to JSON and decoded back
+func equalJSON(expected, actual interface{}) bool {
+	var expectedDecoded, actualDecoded interface{}
+	if json.Unmarshal([]byte(toJSON(expected)), &expectedDecoded) != nil || json.Unmarshal([]byte(toJSON(actual)), &actualDecoded) != nil {
+		return false
+	}
+	return reflect.DeepEqual(expectedDecoded, actualDecoded)
+}
+
+func toJSON(value interface{}) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
+
+// encodeBody the body as is when it is a string, encoded as JSON otherwise. Empty if nil
+func encodeBody(body interface{}) (string, error) {
+	switch value := body.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return value, nil
+	}
+	encoded, err := json.Marshal(body)
+	return string(encoded), err
+}
@@ -0,0 +1,176 @@
+package filtertest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labbsr0x/go-horse/filters"
+	filterConfig "github.com/labbsr0x/go-horse/filters/config-filter"
+	filterdocker "github.com/labbsr0x/go-horse/filters/docker"
+	"github.com/labbsr0x/go-horse/filters/store"
+)
+
+const aclFilter = `{
+	"operations": ["ContainerCreate"],
+	"function": function(ctx) {
+		ctx.values.set("image", ctx.body.Image);
+		if (ctx.body.Image === "redis") {
+			return {next: false, status: 403, body: ctx.body, operation: ctx.operation.READ, error: "redis is not allowed"};
+		}
+		ctx.body.Labels = {team: "ops"};
+		return {next: true, body: ctx.body, operation: ctx.operation.WRITE};
+	}
+}`
+
+const aclFixtures = `
+- name: denies redis
+  request: {method: POST, path: /v1.39/containers/create, body: {Image: redis}}
+  expect: {status: 403, next: false, body: {message: redis is not allowed}, daemonCalled: false}
+- name: labels the containers
+  request: {method: POST, path: /v1.39/containers/create, body: {Image: nginx}}
+  daemon: {status: 201, body: {Id: abc}}
+  expect:
+    status: 201
+    next: true
+    body: {Id: abc}
+    values: {image: nginx}
+    daemonRequest: {path: /v1.39/containers/create, body: {Image: nginx, Labels: {team: ops}}}
+- name: fails
+  request: {method: POST, path: /v1.39/containers/create, body: {Image: nginx}}
+  expect: {status: 201, values: {image: redis}}
+`
+
+func TestRunner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filtertest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "acl.js"), []byte(`{"name": "acl", "invoke": "request",`+aclFilter[1:]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fixturesFile := filepath.Join(dir, "acl-tests.yaml")
+	if err := ioutil.WriteFile(fixturesFile, []byte(aclFixtures), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pluginsDir := filepath.Join(dir, "plugins")
+	if err := os.Mkdir(pluginsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	filterBuilder := &filterConfig.FilterBuilder{FlagsFilter: &filterConfig.FlagsFilter{JsFiltersPath: dir, GoPluginsPath: pluginsDir, JsVMPoolSize: 1}}
+	filter, err := new(filters.FilterManager).InitFromFilterBuilder(filterBuilder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter.ListAPIs.Load()
+	if loadErrors := filter.ListAPIs.LoadErrors(); len(loadErrors) > 0 {
+		t.Fatalf("unexpected load errors %v", loadErrors)
+	}
+	runner, err := NewRunner(filter, "error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	fixtures, err := LoadFixtures(fixturesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) != 3 {
+		t.Fatalf("expected 3 fixtures, got %d", len(fixtures))
+	}
+	for _, fixture := range fixtures[:2] {
+		if result := runner.Run(fixture); !result.Passed() {
+			t.Errorf("expected %s to pass, got %v %v", fixture.Name, result.Error, result.Failures)
+		}
+	}
+	result := runner.Run(fixtures[2])
+	if len(result.Failures) != 2 {
+		t.Errorf("expected the status and value failures, got %v", result.Failures)
+	}
+}
+
+const ownerFilter = `{"name": "owner", "invoke": "request", "operations": ["ContainerStart"],
+	"function": function(ctx) {
+		var container = ctx.docker.inspectContainer(ctx.pathParams.id);
+		if (!container || container.Config.Labels.team !== "ops") {
+			return {next: false, status: 403, body: {}, error: "not an ops container"};
+		}
+		ctx.values.set("image", container.Config.Image);
+		ctx.values.set("starts", ctx.store.incr("starts:" + container.Id, 1));
+		return {next: true};
+	}
+}`
+
+const ownerFixtures = `
+- name: starts the ops containers
+  request: {method: POST, path: /v1.39/containers/abc/start}
+  docker:
+    /containers/abc/json: {body: {Id: abc, Config: {Image: nginx, Labels: {team: ops}}}}
+  daemon: {status: 204, body: ""}
+  expect: {status: 204, values: {image: nginx, starts: 1}, daemonRequest: {path: /v1.39/containers/abc/start}}
+- name: denies the other containers
+  request: {method: POST, path: /v1.39/containers/def/start}
+  docker:
+    /containers/def/json: {body: {Id: def, Config: {Image: nginx, Labels: {team: dev}}}}
+  expect: {status: 403, body: {message: not an ops container}, daemonCalled: false}
+- name: denies the unknown containers
+  request: {method: POST, path: /v1.39/containers/ghi/start}
+  expect: {status: 403, daemonCalled: false}
+- name: streams the logs from the daemon
+  request: {method: GET, path: "/v1.39/containers/abc/logs?stdout=1"}
+  daemon: {body: hello}
+  expect: {status: 200, daemonCalled: true}
+`
+
+func TestRunnerDockerCallsAndStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filtertest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "owner.js"), []byte(ownerFilter), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fixturesFile := filepath.Join(dir, "owner-tests.yaml")
+	if err := ioutil.WriteFile(fixturesFile, []byte(ownerFixtures), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	filterBuilder := &filterConfig.FilterBuilder{FlagsFilter: &filterConfig.FlagsFilter{JsFiltersPath: dir, GoPluginsPath: dir, JsVMPoolSize: 1}}
+	filter, err := new(filters.FilterManager).InitFromFilterBuilder(filterBuilder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filter.Store.Close()
+	filter.ListAPIs.Load()
+	if loadErrors := filter.ListAPIs.LoadErrors(); len(loadErrors) > 0 {
+		t.Fatalf("unexpected load errors %v", loadErrors)
+	}
+	runner, err := NewRunner(filter, "error")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixtures, err := LoadFixtures(fixturesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fixture := range fixtures {
+		if result := runner.Run(fixture); !result.Passed() {
+			t.Errorf("expected %s to pass, got %v %v", fixture.Name, result.Error, result.Failures)
+		}
+	}
+	runner.Close()
+
+	if store.Default() != filter.Store || filterdocker.Client() != nil {
+		t.Fatalf("expected the filters store and docker client back once the runner is closed")
+	}
+	if _, found, _ := filter.Store.Get("starts:abc"); found {
+		t.Fatalf("expected the fixtures to leave the filter manager store untouched")
+	}
+}
@@ -1,17 +1,24 @@
 package plugins
 
 import (
+	"fmt"
 	"github.com/sirupsen/logrus"
 	"io/ioutil"
+	"path/filepath"
 	"plugin"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 
-	"github.com/labbsr0x/go-horse/filters/model"
 	"github.com/kataras/iris"
+	"github.com/labbsr0x/go-horse/filters/model"
 	"github.com/robertkrimen/otto"
 )
 
 // FilterPluginList filters
-var FilterPluginList []GoFilterDefinition
+var FilterPluginList []GoFilter
 
 // JSPluginList plugins to set functions in JS context
 var JSPluginList []JSContextInjection
@@ -22,69 +29,192 @@ type GoFilterDefinition interface {
 	Exec(ctx iris.Context, requestBody string) (model.FilterReturn, error)
 }
 
+// Configurable optional interface of the filters taking settings. Configure is called with the content of the
+// plugin settings sidecar file, like acl.yaml next to acl.so, every time the filters are loaded.
+// Returning an error leaves the filter out
+type Configurable interface {
+	Configure(settings map[string]interface{}) error
+}
+
+// GoFilter a filter plugin and the file it was loaded from
+type GoFilter struct {
+	GoFilterDefinition
+	File string
+}
+
 // JSContextInjection JSContextInjection
 type JSContextInjection interface {
 	Set(ctx iris.Context, call otto.FunctionCall) otto.Value
 	Name() string
 }
 
-// Load Load
-func Load(goPluginsPath string) []GoFilterDefinition {
+// JSNativeInjection optional interface of the JS context injections, called instead of Set with the arguments and
+// the result as plain Go values : nil, bool, numbers, string, slices and maps. The goja filters call the injections
+// that don't implement it through an otto VM
+type JSNativeInjection interface {
+	Call(ctx iris.Context, arguments []interface{}) (interface{}, error)
+}
 
-	if FilterPluginList != nil || JSPluginList != nil {
-		return FilterPluginList
-	}
+// versionPattern plugin file names : acl.v2.so is the version 2 of the acl plugin, acl.so its version 0
+var versionPattern = regexp.MustCompile(`^(.+?)(?:\.v(\d+))?\.so$`)
+
+// loadedPlugin the symbols of an opened plugin file
+type loadedPlugin struct {
+	file    string
+	modTime time.Time
+	filter  GoFilterDefinition
+	js      JSContextInjection
+}
+
+// pluginFile a version of a plugin found in the plugins directory
+type pluginFile struct {
+	version int
+	file    string
+	modTime time.Time
+}
+
+var (
+	loadMutex sync.Mutex
+	// opened the plugin files already opened. Go plugins can't be unloaded nor opened again, a new version
+	// of a plugin must be deployed under a new file name
+	opened = make(map[string]loadedPlugin)
+	// active the version of each plugin in the chain, kept while its newer versions fail to load
+	active = make(map[string]loadedPlugin)
+)
+
+// Load the newest version of each plugin of the directory, along with the errors of the versions that could not be
+// loaded. When a newer version of a plugin can't be loaded, its active version is kept
+func Load(goPluginsPath string) ([]GoFilter, []model.LoadError) {
+	loadMutex.Lock()
+	defer loadMutex.Unlock()
 
 	files, err := ioutil.ReadDir(goPluginsPath)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"error": err.Error(),
 		}).Errorf("Could not load plugins from directory")
+		return FilterPluginList, []model.LoadError{{File: goPluginsPath, Error: fmt.Sprintf("could not read the plugins directory : %v", err)}}
 	}
 
+	versions := make(map[string][]pluginFile)
+	var names []string
 	for _, file := range files {
-
-		logrus.WithFields(logrus.Fields{
-			"file": file.Name(),
-		}).Debugf("Loading plugin")
-
-		plug, err := plugin.Open(goPluginsPath + "/" + file.Name())
-		if err != nil {
-			logrus.WithFields(logrus.Fields{
-				"error": err.Error(),
-				"plugin_path": goPluginsPath+"/"+file.Name(),
-			}).Errorf("Could not open plugin")
+		match := versionPattern.FindStringSubmatch(file.Name())
+		if file.IsDir() || match == nil {
+			continue
+		}
+		version, _ := strconv.Atoi(match[2])
+		if _, ok := versions[match[1]]; !ok {
+			names = append(names, match[1])
+		}
+		versions[match[1]] = append(versions[match[1]], pluginFile{version, filepath.Join(goPluginsPath, file.Name()), file.ModTime()})
+	}
+	sort.Strings(names)
+
+	var loadErrors []model.LoadError
+	var filters []GoFilter
+	var jsPlugins []JSContextInjection
+	current := make(map[string]loadedPlugin)
+	for _, name := range names {
+		candidates := versions[name]
+		sort.Slice(candidates, func(i, j int) bool { return candidates[i].version > candidates[j].version })
+
+		selected, found, failed := loadedPlugin{}, false, false
+		for _, candidate := range candidates {
+			loaded, err := open(candidate)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"error":       err.Error(),
+					"plugin_path": candidate.file,
+				}).Errorf("Could not load plugin")
+				loadErrors = append(loadErrors, model.LoadError{File: candidate.file, Filter: name, Error: err.Error()})
+				failed = true
+				continue
+			}
+			selected, found = loaded, true
+			break
 		}
 
-		symPlugin, err := plug.Lookup("Plugin")
-		if err != nil {
+		// a failing newer version keeps the active version in the chain, rather than an older one
+		previous, wasActive := active[name]
+		if wasActive && (failed || !found) {
+			selected, found = previous, true
+		}
+		if !found {
+			continue
+		}
+		if wasActive && previous.file != selected.file {
 			logrus.WithFields(logrus.Fields{
-				"error": err.Error(),
-				"plugin_path": goPluginsPath+"/"+file.Name(),
-			}).Errorf("Could not load plugin")
+				"plugin": name,
+				"from":   previous.file,
+				"to":     selected.file,
+			}).Warnf("Plugin version replaced")
 		}
+		current[name] = selected
 
-		var filter GoFilterDefinition
-		filter, ok := symPlugin.(GoFilterDefinition)
-		if ok {
-			FilterPluginList = append(FilterPluginList, filter)
-			logrus.WithFields(logrus.Fields{
-				"plugin_name": filter.Config().Name,
-				"type": "filter",
-			}).Debugf("Plugin loaded")
+		if selected.filter != nil {
+			filters = append(filters, GoFilter{selected.filter, selected.file})
 		}
+		if selected.js != nil {
+			jsPlugins = append(jsPlugins, selected.js)
+		}
+	}
 
-		var js JSContextInjection
-		js, ok = symPlugin.(JSContextInjection)
-		if ok {
-			JSPluginList = append(JSPluginList, js)
-			logrus.WithFields(logrus.Fields{
-				"plugin_name": js.Name(),
-				"type": "js",
-			}).Debugf("Plugin loaded")
+	active = current
+	FilterPluginList, JSPluginList = filters, jsPlugins
+	return filters, loadErrors
+}
+
+// open the plugin file, or returns it if already opened
+func open(candidate pluginFile) (loadedPlugin, error) {
+	if loaded, ok := opened[candidate.file]; ok {
+		if !loaded.modTime.Equal(candidate.modTime) {
+			return loaded, fmt.Errorf("the plugin file changed since it was loaded, deploy the new version under a new versioned name")
 		}
+		return loaded, nil
+	}
 
+	logrus.WithFields(logrus.Fields{
+		"file": candidate.file,
+	}).Debugf("Loading plugin")
+
+	plug, err := plugin.Open(candidate.file)
+	if err != nil {
+		return loadedPlugin{}, fmt.Errorf("could not open plugin : %v", err)
 	}
-	return FilterPluginList
+	symPlugin, err := plug.Lookup("Plugin")
+	if err != nil {
+		return loadedPlugin{}, fmt.Errorf("could not load plugin : %v", err)
+	}
+
+	loaded := loadedPlugin{file: candidate.file, modTime: candidate.modTime}
+	if filter, ok := symPlugin.(GoFilterDefinition); ok {
+		loaded.filter = filter
+		logrus.WithFields(logrus.Fields{
+			"plugin_name": filter.Config().Name,
+			"type":        "filter",
+		}).Debugf("Plugin loaded")
+	}
+	if js, ok := symPlugin.(JSContextInjection); ok {
+		loaded.js = js
+		logrus.WithFields(logrus.Fields{
+			"plugin_name": js.Name(),
+			"type":        "js",
+		}).Debugf("Plugin loaded")
+	}
+	if loaded.filter == nil && loaded.js == nil {
+		return loadedPlugin{}, fmt.Errorf("the Plugin symbol is neither a filter nor a JS context injection")
+	}
+	opened[candidate.file] = loaded
+	return loaded, nil
+}
 
+// SettingsFile the plugin file the settings sidecar file is named after : all the versions of a plugin share
+// its settings, acl.v2.so reads acl.yaml
+func SettingsFile(file string) string {
+	match := versionPattern.FindStringSubmatch(filepath.Base(file))
+	if match == nil {
+		return file
+	}
+	return filepath.Join(filepath.Dir(file), match[1]+".so")
 }
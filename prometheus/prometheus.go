@@ -4,6 +4,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/labbsr0x/go-horse/dockerapi"
 	"github.com/labbsr0x/go-horse/version"
 
 	"github.com/kataras/iris/context"
@@ -11,7 +12,8 @@ import (
 )
 
 // Prometheus is a handler that exposes prometheus metrics for the number of requests,
-// the reqLatency and the response size, partitioned by status code, method and HTTP path.
+// the reqLatency and the response size, partitioned by status code, method and Docker API operation.
+// Requests not resolved to a Docker API operation are labeled with their route path.
 //
 // Usage: pass its `ServeHTTP` to a route or globally.
 type MetricsPrometheus struct {
@@ -20,6 +22,11 @@ type MetricsPrometheus struct {
 	reqInFlight   *prometheus.GaugeVec
 	FilterCount   *prometheus.CounterVec
 	FilterLatency *prometheus.HistogramVec
+	JSPoolSize    *prometheus.GaugeVec
+	JSPoolHits    *prometheus.CounterVec
+	JSPoolWaits   *prometheus.CounterVec
+	JSHTTPCount   *prometheus.CounterVec
+	JSHTTPLatency *prometheus.HistogramVec
 }
 
 var name = "go-horse"
@@ -38,38 +45,38 @@ func registerMetrics(p *MetricsPrometheus) {
 	p.reqCount = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name:        "http_requests_total",
-			Help:        "How many HTTP requests processed, partitioned by status code, method and HTTP path.",
+			Help:        "How many HTTP requests processed, partitioned by status code, method and Docker API operation.",
 			ConstLabels: constLabels,
 		},
-		[]string{"code", "method", "path"},
+		[]string{"code", "method", "operation"},
 	)
 	prometheus.MustRegister(p.reqCount)
 
 	p.reqLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Name:        "http_request_duration_seconds",
-		Help:        "How long it took to process the request, partitioned by status code, method and HTTP path.",
+		Help:        "How long it took to process the request, partitioned by status code, method and Docker API operation.",
 		ConstLabels: constLabels,
 	},
-		[]string{"code", "method", "path"},
+		[]string{"code", "method", "operation"},
 	)
 	prometheus.MustRegister(p.reqLatency)
 
 	p.reqInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name:        "http_requests_in_flight_total",
-		Help:        "How many requests are being processed, partitioned method and HTTP path.",
+		Help:        "How many requests are being processed, partitioned method and Docker API operation.",
 		ConstLabels: constLabels,
 	},
-		[]string{"method", "path"},
+		[]string{"method", "operation"},
 	)
 	prometheus.MustRegister(p.reqInFlight)
 
 	p.FilterCount = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name:        "filter_process_total",
-			Help:        "How many filters processed, partitioned by name, invoke time and status code.",
+			Help:        "How many filters processed, partitioned by name, invoke time, status code, outcome (success, error, timeout, panic or limit) and mode (enforce or shadow).",
 			ConstLabels: constLabels,
 		},
-		[]string{"name", "invoke_time", "code"},
+		[]string{"name", "invoke_time", "code", "outcome", "mode"},
 	)
 	prometheus.MustRegister(p.FilterCount)
 
@@ -82,6 +89,54 @@ func registerMetrics(p *MetricsPrometheus) {
 	)
 
 	prometheus.MustRegister(p.FilterLatency)
+
+	p.JSPoolSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "js_filter_vm_pool_size",
+		Help:        "How many JS VMs were created for the filter, partitioned by filter name.",
+		ConstLabels: constLabels,
+	},
+		[]string{"name"},
+	)
+	prometheus.MustRegister(p.JSPoolSize)
+
+	p.JSPoolHits = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:        "js_filter_vm_pool_hits_total",
+			Help:        "How many filter executions reused an idle JS VM, partitioned by filter name.",
+			ConstLabels: constLabels,
+		},
+		[]string{"name"},
+	)
+	prometheus.MustRegister(p.JSPoolHits)
+
+	p.JSPoolWaits = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:        "js_filter_vm_pool_waits_total",
+			Help:        "How many filter executions waited for a JS VM because the pool was exhausted, partitioned by filter name.",
+			ConstLabels: constLabels,
+		},
+		[]string{"name"},
+	)
+	prometheus.MustRegister(p.JSPoolWaits)
+
+	p.JSHTTPCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:        "js_filter_http_requests_total",
+			Help:        "How many HTTP calls the JS filters made, retries included, partitioned by destination host and status code (error when no response was received).",
+			ConstLabels: constLabels,
+		},
+		[]string{"host", "code"},
+	)
+	prometheus.MustRegister(p.JSHTTPCount)
+
+	p.JSHTTPLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:        "js_filter_http_request_duration_seconds",
+		Help:        "How long the HTTP calls of the JS filters took, partitioned by destination host.",
+		ConstLabels: constLabels,
+	},
+		[]string{"host"},
+	)
+	prometheus.MustRegister(p.JSHTTPLatency)
 }
 
 //ServeHTTP returns a new prometheus middleware func.
@@ -91,19 +146,22 @@ func (p *MetricsPrometheus) ServeHTTP(ctx context.Context) {
 		return
 	}
 	start := time.Now()
-	path := ctx.GetCurrentRoute().Path()
+	operation := dockerapi.FromContext(ctx).ID
+	if operation == "" {
+		operation = ctx.GetCurrentRoute().Path()
+	}
 	r := ctx.Request()
 
-	p.reqInFlight.WithLabelValues(r.Method, path).Inc()
+	p.reqInFlight.WithLabelValues(r.Method, operation).Inc()
 
 	ctx.Next()
 
-	p.reqInFlight.WithLabelValues(r.Method, path).Dec()
+	p.reqInFlight.WithLabelValues(r.Method, operation).Dec()
 
 	statusCode := strconv.Itoa(ctx.GetStatusCode())
 
-	p.reqCount.WithLabelValues(statusCode, r.Method, path).
+	p.reqCount.WithLabelValues(statusCode, r.Method, operation).
 		Inc()
-	p.reqLatency.WithLabelValues(statusCode, r.Method, path).
+	p.reqLatency.WithLabelValues(statusCode, r.Method, operation).
 		Observe(float64(time.Since(start).Seconds()) / 1000000000)
 }
@@ -1,6 +1,8 @@
 package util
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
 	"runtime"
 	"strings"
@@ -16,22 +18,160 @@ import (
 // You can use this function to Set and Get local values
 // that can be used to share information between handlers and middleware >> AND THE PROXY FILTERS
 
-// RequestScopeGet RequestScopeGet
+// PathKey request scope key of the path sent to the daemon. Filters can change it, to a string
+const PathKey = "path"
+
+const (
+	// RequestBodyKey and ResponseBodyKey request scope keys of the bodies read by the proxy
+	RequestBodyKey  = "requestBody"
+	ResponseBodyKey = "responseBody"
+	// ResponseStatusCodeKey request scope key of the status of the daemon response
+	ResponseStatusCodeKey = "responseStatusCode"
+)
+
+// protectedKeys request scope keys of the values go-horse sets for itself, the filters can read them but not set them
+var protectedKeys = map[string]bool{
+	RequestBodyKey:        true,
+	ResponseBodyKey:       true,
+	ResponseStatusCodeKey: true,
+}
+
+// ProtectRequestScopeKeys protects request scope keys of values go-horse sets for itself. The packages owning the
+// keys call it from their init
+func ProtectRequestScopeKeys(keys ...string) {
+	for _, key := range keys {
+		protectedKeys[key] = true
+	}
+}
+
+// protectedPrefixes prefixes of the environment and build values
+var protectedPrefixes = []string{"ENV_", "CONFIG_"}
+
+// IsProtectedKey tells if the key holds a go-horse value the filters can't set
+func IsProtectedKey(key string) bool {
+	if protectedKeys[key] {
+		return true
+	}
+	for _, prefix := range protectedPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequestScopeGet the value as a string. Strings are returned as is, other values encoded as JSON
 func RequestScopeGet(ctx iris.Context, key string) string {
+	value := ctx.Values().Get(key)
+	if text, ok := value.(string); ok || value == nil {
+		return text
+	}
+	if encoded, err := json.Marshal(value); err == nil {
+		return string(encoded)
+	}
 	return ctx.Values().GetString(key)
 }
 
-// RequestScopeSet RequestScopeSet
-func RequestScopeSet(ctx iris.Context, key, value string) {
-	ctx.Values().Set(key, value)
+// RequestScopeSet stores any JSON compatible value, shared by the filters until the end of the request. The value is
+// copied through JSON, structs are stored as the objects of their JSON encoding. It fails for the protected keys and
+// for a path that is not a string
+func RequestScopeSet(ctx iris.Context, key string, value interface{}) error {
+	if IsProtectedKey(key) {
+		return fmt.Errorf("the request value %s is set by go-horse, it can't be changed", key)
+	}
+	if _, ok := value.(string); key == PathKey && !ok {
+		return fmt.Errorf("the request value %s must be a string, got %T", key, value)
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("the request value %s can't be encoded as JSON : %v", key, err)
+	}
+	var copied interface{}
+	if err := json.Unmarshal(encoded, &copied); err != nil {
+		return fmt.Errorf("the request value %s can't be decoded from JSON : %v", key, err)
+	}
+	ctx.Values().Set(key, copied)
+	return nil
 }
 
-// RequestScopeList RequestScopeList
+// RequestScopeValue the raw value : nil, bool, float64, string, []interface{} or map[string]interface{} for the
+// values set by the filters
+func RequestScopeValue(ctx iris.Context, key string) (interface{}, bool) {
+	entry, ok := ctx.Values().GetEntry(key)
+	if !ok {
+		return nil, false
+	}
+	return entry.ValueRaw, true
+}
+
+// RequestScopeString the value if it is a string
+func RequestScopeString(ctx iris.Context, key string) (string, bool) {
+	value, ok := ctx.Values().Get(key).(string)
+	return value, ok
+}
+
+// RequestScopeNumber the value if it is a number
+func RequestScopeNumber(ctx iris.Context, key string) (float64, bool) {
+	switch value := ctx.Values().Get(key).(type) {
+	case float64:
+		return value, true
+	case int:
+		return float64(value), true
+	case int64:
+		return float64(value), true
+	}
+	return 0, false
+}
+
+// RequestScopeBool the value if it is a boolean
+func RequestScopeBool(ctx iris.Context, key string) (bool, bool) {
+	value, ok := ctx.Values().Get(key).(bool)
+	return value, ok
+}
+
+// RequestScopeObject the value if it is an object
+func RequestScopeObject(ctx iris.Context, key string) (map[string]interface{}, bool) {
+	value, ok := ctx.Values().Get(key).(map[string]interface{})
+	return value, ok
+}
+
+// RequestScopeArray the value if it is an array
+func RequestScopeArray(ctx iris.Context, key string) ([]interface{}, bool) {
+	value, ok := ctx.Values().Get(key).([]interface{})
+	return value, ok
+}
+
+// RequestScopeDecode decodes the value into target, through JSON, like an identity object into its struct
+func RequestScopeDecode(ctx iris.Context, key string, target interface{}) error {
+	value, ok := RequestScopeValue(ctx, key)
+	if !ok {
+		return fmt.Errorf("no request value %s", key)
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, target)
+}
+
+// RequestScopeList all the values as strings, like RequestScopeGet returns them
 func RequestScopeList(ctx iris.Context) map[string]string {
 	values := make(map[string]string)
+	for key := range RequestScopeValues(ctx) {
+		values[key] = RequestScopeGet(ctx, key)
+	}
+	return values
+}
+
+// RequestScopeValues the JSON compatible values, the filters and go-horse ones. Go-horse internal objects are left out
+func RequestScopeValues(ctx iris.Context) map[string]interface{} {
+	values := make(map[string]interface{})
 	ctx.Values().Visit(
 		func(key string, value interface{}) {
-			values[key] = ctx.Values().GetString(key)
+			switch value.(type) {
+			case nil, bool, string, float64, int, int64, []interface{}, map[string]interface{}:
+				values[key] = value
+			}
 		})
 	return values
 }
@@ -0,0 +1,71 @@
+package util
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/context"
+)
+
+func newContext() iris.Context {
+	ctx := context.NewContext(iris.New())
+	ctx.BeginRequest(httptest.NewRecorder(), httptest.NewRequest("GET", "/containers/json", nil))
+	return ctx
+}
+
+func TestRequestScopeTypedValues(t *testing.T) {
+	ctx := newContext()
+	identity := map[string]interface{}{"user": "ana", "teams": []string{"ops", "dev"}, "admin": true}
+	if err := RequestScopeSet(ctx, "identity", identity); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	object, ok := RequestScopeObject(ctx, "identity")
+	if !ok || object["user"] != "ana" || object["admin"] != true {
+		t.Errorf("expected the identity object, got %#v", ctx.Values().Get("identity"))
+	}
+	if teams, ok := object["teams"].([]interface{}); !ok || len(teams) != 2 {
+		t.Errorf("expected the teams array, got %#v", object["teams"])
+	}
+
+	var decoded struct {
+		User  string
+		Teams []string
+	}
+	if err := RequestScopeDecode(ctx, "identity", &decoded); err != nil || decoded.User != "ana" || len(decoded.Teams) != 2 {
+		t.Errorf("expected the decoded identity, got %#v, %v", decoded, err)
+	}
+
+	_ = RequestScopeSet(ctx, "count", 3)
+	if count, ok := RequestScopeNumber(ctx, "count"); !ok || count != 3 {
+		t.Errorf("expected the number 3, got %v", count)
+	}
+	if RequestScopeGet(ctx, "count") != "3" {
+		t.Errorf("expected the string 3, got %q", RequestScopeGet(ctx, "count"))
+	}
+	if _, ok := RequestScopeString(ctx, "count"); ok {
+		t.Errorf("a number is not a string")
+	}
+	if _, ok := RequestScopeValues(ctx)["identity"]; !ok {
+		t.Errorf("expected the identity in the values list")
+	}
+}
+
+func TestRequestScopeProtectedKeys(t *testing.T) {
+	ctx := newContext()
+	ctx.Values().Set("requestBody", "{}")
+	for _, key := range []string{"requestBody", "responseStatusCode", "ENV_HOME", "CONFIG_VERSION"} {
+		if err := RequestScopeSet(ctx, key, "x"); err == nil {
+			t.Errorf("%s : expected a protected key error", key)
+		}
+	}
+	if ctx.Values().GetString("requestBody") != "{}" {
+		t.Errorf("the request body was overwritten")
+	}
+	if err := RequestScopeSet(ctx, PathKey, map[string]interface{}{}); err == nil {
+		t.Errorf("expected an error for a path that is not a string")
+	}
+	if err := RequestScopeSet(ctx, PathKey, "/v1.39/info"); err != nil || ctx.Values().GetString(PathKey) != "/v1.39/info" {
+		t.Errorf("expected the path to be set, got %v", err)
+	}
+}
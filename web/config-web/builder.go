@@ -3,6 +3,7 @@ package web
 import (
 	"fmt"
 	"github.com/labbsr0x/go-horse/filters"
+	filterdocker "github.com/labbsr0x/go-horse/filters/docker"
 	"github.com/docker/docker/api"
 	"github.com/sirupsen/logrus"
 	"net/http"
@@ -69,6 +70,7 @@ func (b *WebBuilder) InitFromViper(v *viper.Viper, filter *filters.FilterManager
 
 	b.Flags = flags
 	b.DockerCli = b.getDockerCli()
+	filterdocker.SetClient(b.DockerCli)
 	b.SockClient = b.getSocketClient()
 	b.Filter = filter
 
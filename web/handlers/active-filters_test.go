@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/context"
+	"github.com/labbsr0x/go-horse/filters"
+	filterConfig "github.com/labbsr0x/go-horse/filters/config-filter"
+	web "github.com/labbsr0x/go-horse/web/config-web"
+)
+
+func TestActiveFiltersHidesSettings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "active-filters")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filter := `{"name": "acl", "invoke": "request", "function": function(ctx) { return {next: true}; }}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "acl.js"), []byte(filter), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "acl.yaml"), []byte("token: s3cr3t\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	filterBuilder := &filterConfig.FilterBuilder{FlagsFilter: &filterConfig.FlagsFilter{JsFiltersPath: dir, GoPluginsPath: dir, JsVMPoolSize: 1}}
+	filterManager, err := new(filters.FilterManager).InitFromFilterBuilder(filterBuilder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filterManager.Store.Close()
+	filterManager.ListAPIs.Load()
+	if filters := filterManager.ListAPIs.RequestFilters(); len(filters) != 1 || filters[0].Config().Settings["token"] != "s3cr3t" {
+		t.Fatalf("expected the acl filter with its settings, got %v and errors %v", filters, filterManager.ListAPIs.LoadErrors())
+	}
+
+	recorder := httptest.NewRecorder()
+	ctx := context.NewContext(iris.New())
+	ctx.BeginRequest(recorder, httptest.NewRequest("GET", "/active-filters", nil))
+	new(DefaultActiveFiltersAPI).InitFromWebBuilder(&web.WebBuilder{Filter: filterManager}).ActiveFiltersHandler(ctx)
+
+	body := recorder.Body.String()
+	if !strings.Contains(body, `"acl"`) || strings.Contains(body, "s3cr3t") {
+		t.Fatalf("expected the acl filter without its settings, got %s", body)
+	}
+}
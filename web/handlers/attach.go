@@ -27,6 +27,10 @@ func (dapi *DefaultAttachAPI) InitFromWebBuilder(webBuilder *web.WebBuilder) *De
 // AttachHandler handle attach command
 func (dapi *DefaultAttachAPI) AttachHandler(ctx iris.Context) {
 
+	if serveSyntheticResponse(ctx) {
+		return
+	}
+
 	params := ctx.FormValues()
 
 	options := types.ContainerAttachOptions{}
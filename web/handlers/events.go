@@ -29,6 +29,10 @@ func (dapi *DefaultEventsAPI) InitFromWebBuilder(webBuilder *web.WebBuilder) *De
 // EventsHandler handle logs command
 func (dapi *DefaultEventsAPI) EventsHandler(ctx iris.Context) {
 
+	if serveSyntheticResponse(ctx) {
+		return
+	}
+
 	contextWithCancel, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -28,6 +28,10 @@ func (dapi *DefaultExecAPI) InitFromWebBuilder(webBuilder *web.WebBuilder) *Defa
 // ExecHandler handle the exec command
 func (dapi *DefaultExecAPI) ExecHandler(ctx iris.Context) {
 
+	if serveSyntheticResponse(ctx) {
+		return
+	}
+
 	var execStartCheck types.ExecStartCheck
 
 	if err := ctx.ReadJSON(&execStartCheck); err != nil {
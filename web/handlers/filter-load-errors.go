@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	web "github.com/labbsr0x/go-horse/web/config-web"
+	"github.com/kataras/iris"
+	"github.com/labbsr0x/go-horse/filters/model"
+)
+
+type FilterLoadErrorsAPI interface {
+	FilterLoadErrorsHandler(ctx iris.Context)
+}
+
+type DefaultFilterLoadErrorsAPI struct {
+	*web.WebBuilder
+}
+
+// InitFromWebBuilder initializes a default load errors api instance from a web builder instance
+func (dapi *DefaultFilterLoadErrorsAPI) InitFromWebBuilder(webBuilder *web.WebBuilder) *DefaultFilterLoadErrorsAPI {
+	dapi.WebBuilder = webBuilder
+	return dapi
+}
+
+// FilterLoadErrorsHandler lists the errors found on the last filters load, the filters left out and the ignored definitions
+func (dapi *DefaultFilterLoadErrorsAPI) FilterLoadErrorsHandler(ctx iris.Context) {
+	loadErrors := dapi.Filter.ListAPIs.LoadErrors()
+	if loadErrors == nil {
+		loadErrors = []model.LoadError{}
+	}
+	_, _ = ctx.JSON(iris.Map{
+		"errors": loadErrors,
+	})
+}
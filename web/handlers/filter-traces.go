@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	web "github.com/labbsr0x/go-horse/web/config-web"
+	"github.com/kataras/iris"
+)
+
+type FilterTracesAPI interface {
+	FilterTracesHandler(ctx iris.Context)
+	FilterTraceHandler(ctx iris.Context)
+}
+
+type DefaultFilterTracesAPI struct {
+	*web.WebBuilder
+}
+
+// InitFromWebBuilder initializes a default filter traces api instance from a web builder instance
+func (dapi *DefaultFilterTracesAPI) InitFromWebBuilder(webBuilder *web.WebBuilder) *DefaultFilterTracesAPI {
+	dapi.WebBuilder = webBuilder
+	return dapi
+}
+
+// FilterTracesHandler lists the filter traces of the last requests, newest first
+func (dapi *DefaultFilterTracesAPI) FilterTracesHandler(ctx iris.Context) {
+	_, _ = ctx.JSON(dapi.Filter.Traces.List())
+}
+
+// FilterTraceHandler gets the filter trace of a request by its ID
+func (dapi *DefaultFilterTracesAPI) FilterTraceHandler(ctx iris.Context) {
+	requestTrace, ok := dapi.Filter.Traces.Get(ctx.Params().Get("id"))
+	if !ok {
+		ctx.StatusCode(iris.StatusNotFound)
+		_, _ = ctx.JSON(iris.Map{"message": "trace not found"})
+		return
+	}
+	_, _ = ctx.JSON(requestTrace)
+}
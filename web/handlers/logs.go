@@ -29,6 +29,10 @@ func (dapi *DefaultLogsAPI) InitFromWebBuilder(webBuilder *web.WebBuilder) *Defa
 // LogsHandler handle logs command
 func (dapi *DefaultLogsAPI) LogsHandler(ctx iris.Context) {
 
+	if serveSyntheticResponse(ctx) {
+		return
+	}
+
 	params := ctx.FormValues()
 
 	options := types.ContainerLogsOptions{
@@ -9,14 +9,16 @@ import (
 	"strings"
 
 	"github.com/labbsr0x/go-horse/filters/model"
+	"github.com/labbsr0x/go-horse/filters/trace"
+	"github.com/labbsr0x/go-horse/util"
 	web "github.com/labbsr0x/go-horse/web/config-web"
 
 	"github.com/kataras/iris"
 )
 
 const (
-	RequestBodyKey  = "requestBody"
-	ResponseBodyKey = "responseBody"
+	RequestBodyKey  = util.RequestBodyKey
+	ResponseBodyKey = util.ResponseBodyKey
 )
 
 type ProxyAPI interface {
@@ -37,6 +39,10 @@ func (dapi *DefaultProxyAPI) ProxyHandler(ctx iris.Context) {
 		"request": ctx.String(),
 	}).Debugf("Receiving")
 
+	if serveSyntheticResponse(ctx) {
+		return
+	}
+
 	u := ctx.Request().URL.ResolveReference(&url.URL{Path: ctx.Values().GetString("path"), RawQuery: ctx.Request().URL.RawQuery})
 	path := u.String()
 
@@ -53,6 +59,10 @@ func (dapi *DefaultProxyAPI) ProxyHandler(ctx iris.Context) {
 		request.Header[key] = value
 	}
 
+	if headers, ok := ctx.Values().Get(model.RequestHeadersKey).(model.HeaderOperations); ok {
+		headers.Apply(request.Header)
+	}
+
 	logrus.WithFields(logrus.Fields{
 		"URL": path,
 	}).Debugf("Executing request for URL")
@@ -106,7 +116,7 @@ func (dapi *DefaultProxyAPI) ProxyHandler(ctx iris.Context) {
 	}
 
 	ctx.Values().Set(ResponseBodyKey, string(responseBody))
-	ctx.Values().Set("responseStatusCode", response.StatusCode)
+	ctx.Values().Set(util.ResponseStatusCodeKey, response.StatusCode)
 
 	result, errr := dapi.Filter.RunResponseFilters(ctx, ResponseBodyKey)
 
@@ -118,6 +128,11 @@ func (dapi *DefaultProxyAPI) ProxyHandler(ctx iris.Context) {
 		return
 	}
 
+	if headers, ok := ctx.Values().Get(model.ResponseHeadersKey).(model.HeaderOperations); ok {
+		headers.Apply(ctx.ResponseWriter().Header())
+	}
+
+	trace.WriteHeader(ctx)
 	ctx.StatusCode(fixZeroStatus(result, response))
 	ctx.ContentType("application/json")
 	ctx.WriteString(ctx.Values().GetString(ResponseBodyKey))
@@ -29,6 +29,10 @@ func (dapi *DefaultStatsAPI) InitFromWebBuilder(webBuilder *web.WebBuilder) *Def
 // StatsHandler handle logs command
 func (dapi *DefaultStatsAPI) StatsHandler(ctx iris.Context) {
 
+	if serveSyntheticResponse(ctx) {
+		return
+	}
+
 	params := ctx.FormValues()
 
 	response, err := dapi.DockerCli.ContainerStats(context.Background(), ctx.Params().Get("containerId"), util.GetRequestParameter(params, "stream") == "1")
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labbsr0x/go-horse/filters/model"
+	"github.com/labbsr0x/go-horse/filters/trace"
+
+	"github.com/kataras/iris"
+	"github.com/sirupsen/logrus"
+)
+
+// serveSyntheticResponse serves the response returned by a request filter, if any, without calling the daemon
+func serveSyntheticResponse(ctx iris.Context) bool {
+	response, ok := ctx.Values().Get(model.SyntheticResponseKey).(*model.SyntheticResponse)
+	if !ok || response == nil {
+		return false
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"request": ctx.String(),
+		"status":  response.Status,
+	}).Debugf("Serving synthetic response")
+
+	for key, value := range response.Headers {
+		ctx.ResponseWriter().Header().Set(key, value)
+	}
+
+	contentType := response.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	status := response.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	trace.WriteHeader(ctx)
+	ctx.ContentType(contentType)
+	ctx.StatusCode(status)
+	ctx.WriteString(response.Body)
+	return true
+}
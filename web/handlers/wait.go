@@ -30,6 +30,10 @@ func (dapi *DefaultWaitAPI) InitFromWebBuilder(webBuilder *web.WebBuilder) *Defa
 // WaitHandler lero lero
 func (dapi *DefaultWaitAPI) WaitHandler(ctx iris.Context) {
 
+	if serveSyntheticResponse(ctx) {
+		return
+	}
+
 	params := ctx.FormValues()
 	condition := util.GetRequestParameter(params, "condition")
 
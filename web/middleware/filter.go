@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"github.com/labbsr0x/go-horse/filters"
+	"github.com/labbsr0x/go-horse/filters/trace"
 	"github.com/labbsr0x/go-horse/util"
 	"github.com/kataras/iris/context"
 	"github.com/sirupsen/logrus"
@@ -10,8 +11,8 @@ import (
 
 
 const (
-	RequestBodyKey  = "requestBody"
-	ResponseBodyKey = "responseBody"
+	RequestBodyKey  = util.RequestBodyKey
+	ResponseBodyKey = util.ResponseBodyKey
 )
 
 
@@ -31,9 +32,10 @@ func ResquestFilter(filter * filters.FilterManager) context.Handler {
 			ctx.Values().Set(RequestBodyKey, string(requestBody))
 		}
 
-		ctx.Values().Set("path", ctx.Request().URL.Path)
+		ctx.Values().Set(util.PathKey, ctx.Request().URL.Path)
 
 		_, err := filter.RunRequestFilters(ctx, RequestBodyKey)
+		trace.WriteHeader(ctx)
 
 		writer := ctx.ResponseWriter()
 		ctx.ResetResponseWriter(writer)
@@ -42,7 +44,6 @@ func ResquestFilter(filter * filters.FilterManager) context.Handler {
 			logrus.WithFields(logrus.Fields{
 				"error": err.Error(),
 			}).Errorf("Error during the execution of REQUEST filters")
-			writer.WriteString(err.Error())
 			ctx.StopExecution()
 			return
 		}
@@ -19,20 +19,24 @@ import (
 // Server holds the information needed to run Whisper
 type Server struct {
 	*web.WebBuilder
-	ActiveFiltersAPIs handlers.ActiveFiltersAPI
-	AttachAPIs        handlers.AttachAPI
-	LogsAPIs          handlers.LogsAPI
-	WaitAPIs          handlers.WaitAPI
-	ExecAPIs          handlers.ExecAPI
-	StatsAPIs         handlers.StatsAPI
-	EventsAPIs        handlers.EventsAPI
-	ProxyAPIs         handlers.ProxyAPI
+	ActiveFiltersAPIs    handlers.ActiveFiltersAPI
+	FilterTracesAPIs     handlers.FilterTracesAPI
+	FilterLoadErrorsAPIs handlers.FilterLoadErrorsAPI
+	AttachAPIs           handlers.AttachAPI
+	LogsAPIs             handlers.LogsAPI
+	WaitAPIs             handlers.WaitAPI
+	ExecAPIs             handlers.ExecAPI
+	StatsAPIs            handlers.StatsAPI
+	EventsAPIs           handlers.EventsAPI
+	ProxyAPIs            handlers.ProxyAPI
 }
 
 // InitFromWebBuilder builds a Server instance
 func (s *Server) InitFromWebBuilder(webBuilder *web.WebBuilder) *Server {
 	s.WebBuilder = webBuilder
 	s.ActiveFiltersAPIs = new(handlers.DefaultActiveFiltersAPI).InitFromWebBuilder(webBuilder)
+	s.FilterTracesAPIs = new(handlers.DefaultFilterTracesAPI).InitFromWebBuilder(webBuilder)
+	s.FilterLoadErrorsAPIs = new(handlers.DefaultFilterLoadErrorsAPI).InitFromWebBuilder(webBuilder)
 	s.AttachAPIs = new(handlers.DefaultAttachAPI).InitFromWebBuilder(webBuilder)
 	s.LogsAPIs = new(handlers.DefaultLogsAPI).InitFromWebBuilder(webBuilder)
 	s.WaitAPIs = new(handlers.DefaultWaitAPI).InitFromWebBuilder(webBuilder)
@@ -53,12 +57,20 @@ func (s *Server) InitFromWebBuilder(webBuilder *web.WebBuilder) *Server {
 
 // Run initializes the web server and its apis
 func (s *Server) Run() error {
+	return s.ListenAndServe(s.App())
+}
+
+// App the go-horse application : its apis, the filters middleware and the daemon handlers
+func (s *Server) App() *iris.Application {
 
 	app := iris.New()
 	app.Use(recover.New())
 	app.Use(prometheus.GetMetrics().ServeHTTP)
 
 	app.Get("/active-filters", s.ActiveFiltersAPIs.ActiveFiltersHandler)
+	app.Get("/filter-traces", s.FilterTracesAPIs.FilterTracesHandler)
+	app.Get("/filter-traces/{id:string}", s.FilterTracesAPIs.FilterTraceHandler)
+	app.Get("/filter-load-errors", s.FilterLoadErrorsAPIs.FilterLoadErrorsHandler)
 	app.Get("/metrics", iris.FromStd(promhttp.Handler()))
 
 	app.Use(middleware.ResquestFilter(s.Filter))
@@ -72,7 +84,7 @@ func (s *Server) Run() error {
 	app.Get("/{version:string}/events", s.EventsAPIs.EventsHandler)
 	app.Any("*", s.ProxyAPIs.ProxyHandler)
 
-	return s.ListenAndServe(app)
+	return app
 }
 
 func (s *Server) ListenAndServe(app *iris.Application) error {
@@ -94,7 +106,7 @@ func (s *Server) ListenAndServe(app *iris.Application) error {
 		defer cancel()
 
 		if err := app.Shutdown(ctx); err != nil{
-			logrus.Fatal("server finalization error: %v", err)
+			logrus.Fatalf("server finalization error: %v", err)
 		}
 
 		logrus.Info("Server Exited Properly")